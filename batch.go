@@ -1,38 +1,139 @@
 package main
 
 import (
-	"log"
-	"os"
+	"fmt"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type batchSpec struct {
-	Name          string    `yaml:"name"`
-	IsDistributed bool      `yaml:"distributed"`
-	IsWorker      bool      `yaml:"worker"`
-	Url           string    `yaml:"url"`
-	Runs          []runConf `yaml:"runs"`
-	Output        string    `yaml:"output"`
+	Name           string               `yaml:"name"`
+	IsDistributed  bool                 `yaml:"distributed"`
+	IsWorker       bool                 `yaml:"worker"`
+	Url            string               `yaml:"url"`
+	Runs           []runConf            `yaml:"runs"`
+	Include        []string             `yaml:"include"`
+	Templates      map[string]yaml.Node `yaml:"templates"`
+	Output         string               `yaml:"output"`
+	IDHeader       string               `yaml:"id_header"`
+	IDFormat       string               `yaml:"id_format"`
+	IDLocation     string               `yaml:"id_location"`
+	Trace          string               `yaml:"trace"`
+	TraceState     string               `yaml:"tracestate"`
+	RawLog         string               `yaml:"raw_log"`
+	RawFormat      string               `yaml:"raw_format"`
+	Interval       time.Duration        `yaml:"interval"`
+	JSONReport     string               `yaml:"json"`
+	SeriesFile     string               `yaml:"series"`
+	HTMLReport     string               `yaml:"html"`
+	Protocol       string               `yaml:"protocol"`
+	UnixSocket     string               `yaml:"unix_socket"`
+	Dial           string               `yaml:"dial"`
+	Proxy          string               `yaml:"proxy"`
+	Client         clientOptions        `yaml:"client"`
+	Matrix         yaml.Node            `yaml:"matrix"`
+	Headers        map[string]string    `yaml:"headers"`
+	Before         []hookSpec           `yaml:"before"`
+	After          []hookSpec           `yaml:"after"`
+	TLS            tlsOptions           `yaml:",inline"`
+	Type           string               `yaml:"type"`
+	Method         string               `yaml:"method"`
+	ProtoSet       string               `yaml:"proto_set"`
+	Body           string               `yaml:"body"`
+	Query          string               `yaml:"query"`
+	Variables      string               `yaml:"variables"`
+	Operation      string               `yaml:"operation"`
+	WSRate         float64              `yaml:"ws_rate"`
+	WSReply        bool                 `yaml:"ws_reply"`
+	SSEDuration    time.Duration        `yaml:"sse_duration"`
+	Warmup         time.Duration        `yaml:"warmup"`
+	WarmupRequests int                  `yaml:"warmup_requests"`
+	PauseBefore    time.Duration        `yaml:"pause_before"`
+	PauseAfter     time.Duration        `yaml:"pause_after"`
+	StopOnFailure  bool                 `yaml:"stop_on_failure"`
+	MetricsAddr    string               `yaml:"metrics_addr"`
 }
 
 type runConf struct {
-	Requests    int    `yaml:"requests"`
-	Concurrency int    `yaml:"concurrency"`
-	CustomURL   string `yaml:"url"`
-	CustomID    string `yaml:"id"`
+	Requests       int               `yaml:"requests"`
+	Concurrency    int               `yaml:"concurrency"`
+	CustomURL      string            `yaml:"url"`
+	CustomID       string            `yaml:"id"`
+	IDHeader       string            `yaml:"id_header"`
+	IDFormat       string            `yaml:"id_format"`
+	IDLocation     string            `yaml:"id_location"`
+	Trace          string            `yaml:"trace"`
+	TraceState     string            `yaml:"tracestate"`
+	Interval       time.Duration     `yaml:"interval"`
+	Protocol       string            `yaml:"protocol"`
+	UnixSocket     string            `yaml:"unix_socket"`
+	Dial           string            `yaml:"dial"`
+	Proxy          string            `yaml:"proxy"`
+	Client         clientOptions     `yaml:"client"`
+	Label          string            `yaml:"label"`
+	Headers        map[string]string `yaml:"headers"`
+	Before         []hookSpec        `yaml:"before"`
+	After          []hookSpec        `yaml:"after"`
+	Params         []matrixParam     `yaml:"-"`
+	Type           string            `yaml:"type"`
+	Method         string            `yaml:"method"`
+	Body           string            `yaml:"body"`
+	Query          string            `yaml:"query"`
+	Variables      string            `yaml:"variables"`
+	Operation      string            `yaml:"operation"`
+	WSRate         float64           `yaml:"ws_rate"`
+	SSEDuration    time.Duration     `yaml:"sse_duration"`
+	Warmup         time.Duration     `yaml:"warmup"`
+	WarmupRequests int               `yaml:"warmup_requests"`
+	PauseBefore    time.Duration     `yaml:"pause_before"`
+	PauseAfter     time.Duration     `yaml:"pause_after"`
+	Repeat         int               `yaml:"repeat"`
+	StopOnFailure  *bool             `yaml:"stop_on_failure"`
+	ParallelGroup  string            `yaml:"parallel_group"`
+	Extends        string            `yaml:"extends"`
+	Feeders        []feederSpec      `yaml:"feeders"`
+	Scenario       []scenarioStep    `yaml:"scenario"`
 }
 
-func (conf *batchSpec) getConf(filename string) *batchSpec {
+// getConf loads a batch file with the files it includes, rejecting unknown keys, applies run templates and expands
+// its matrix and repeated runs. The returned lines are used to locate invalid values.
+func (conf *batchSpec) getConf(filename string, vars map[string]string) (specLines, error) {
+	lines := specLines{file: filename, files: make(map[*yaml.Node]string)}
 
-	fileBytes, err := os.ReadFile(filename)
+	root, err := loadSpecFile(filename, vars, lines.files, nil)
 	if err != nil {
-		log.Printf("Error reading file: %v\n", err)
+		return lines, err
 	}
-	err = yaml.Unmarshal(fileBytes, conf)
-	if err != nil {
-		log.Fatalf("Error unmarshalling yaml: %v\n", err)
+	if err := resolveTemplates(root, lines.files); err != nil {
+		return lines, err
+	}
+	if err := decodeStrict(root, conf); err != nil {
+		return lines, fmt.Errorf("%s: %s", filename, yamlErrorText(err))
+	}
+	lines.doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}
+	// decoding goes through a generated document, so the matrix is taken from the files to keep its lines
+	if m := lines.find("matrix"); m != nil {
+		conf.Matrix = *m
+	}
+
+	var runNodes []*yaml.Node
+	if runs := mappingValue(root, "runs"); runs != nil {
+		runNodes = runs.Content
+	}
+	if lines.origins, err = conf.expandMatrix(runNodes, lines.files); err != nil {
+		return lines, fmt.Errorf("%s: %v", lines.fileOf(lines.find("matrix")), err)
 	}
+	lines.origins = conf.expandRepeats(lines.origins)
+	return lines, nil
+}
 
-	return conf
+// override returns the first non-empty value, so run fields take precedence over batch fields
+func override(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
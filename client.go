@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/http2"
+)
+
+// Supported protocols for target requests
+const (
+	protocolHTTP1 string = "http1"
+	protocolH2    string = "h2"
+	protocolH2C   string = "h2c"
+)
+
+const dialTimeout = 3 * time.Second
+
+// targetClient performs requests built by sendRequest. fasthttp.Client implements it directly,
+// other transports are adapted so that ids, metrics and timeouts behave the same for all of them.
+type targetClient interface {
+	Do(req *fasthttp.Request, resp *fasthttp.Response) error
+}
+
+// clientOptions are the client settings for target requests, set with flags or with a client block
+// at the test or run level. Unset fields fall back to the next level.
+type clientOptions struct {
+	ReadTimeout         time.Duration `yaml:"read_timeout"`
+	WriteTimeout        time.Duration `yaml:"write_timeout"`
+	MaxConns            int           `yaml:"max_conns"`
+	KeepAlive           *bool         `yaml:"keep_alive"`
+	MaxIdleConnDuration time.Duration `yaml:"max_idle_conn_duration"`
+	ReadBufferSize      int           `yaml:"read_buffer_size"`
+	WriteBufferSize     int           `yaml:"write_buffer_size"`
+	NormalizeHeaders    *bool         `yaml:"normalize_headers"`
+}
+
+// over returns the options with unset fields taken from base
+func (o clientOptions) over(base clientOptions) clientOptions {
+	if o.ReadTimeout == 0 {
+		o.ReadTimeout = base.ReadTimeout
+	}
+	if o.WriteTimeout == 0 {
+		o.WriteTimeout = base.WriteTimeout
+	}
+	if o.MaxConns == 0 {
+		o.MaxConns = base.MaxConns
+	}
+	if o.KeepAlive == nil {
+		o.KeepAlive = base.KeepAlive
+	}
+	if o.MaxIdleConnDuration == 0 {
+		o.MaxIdleConnDuration = base.MaxIdleConnDuration
+	}
+	if o.ReadBufferSize == 0 {
+		o.ReadBufferSize = base.ReadBufferSize
+	}
+	if o.WriteBufferSize == 0 {
+		o.WriteBufferSize = base.WriteBufferSize
+	}
+	if o.NormalizeHeaders == nil {
+		o.NormalizeHeaders = base.NormalizeHeaders
+	}
+	return o
+}
+
+// dialFunc opens the raw connection used to reach a target address
+type dialFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+type clientConf struct {
+	protocol   string
+	target     string
+	options    clientOptions
+	tlsConfig  *tls.Config
+	stats      *connStats
+	unixSocket string
+	dialAddr   string
+	proxy      *url.URL
+}
+
+// connStats counts connections opened by a client. Fields are updated atomically from dialers.
+type connStats struct {
+	dials          int64
+	handshakes     int64
+	handshakeFails int64
+	handshakeNanos int64
+	proxyConnects  int64
+	proxyFails     int64
+	proxyNanos     int64
+}
+
+type connSummary struct {
+	Connections    int64   `json:"connections"`
+	TLSHandshakes  int64   `json:"tls_handshakes,omitempty"`
+	TLSFailures    int64   `json:"tls_failures,omitempty"`
+	TLSHandshakeMs float64 `json:"tls_handshake_mean_ms,omitempty"`
+	ProxyConnects  int64   `json:"proxy_connects,omitempty"`
+	ProxyFailures  int64   `json:"proxy_failures,omitempty"`
+	ProxyConnectMs float64 `json:"proxy_connect_mean_ms,omitempty"`
+}
+
+func (s *connStats) summary() connSummary {
+	sum := connSummary{
+		Connections:   atomic.LoadInt64(&s.dials),
+		TLSHandshakes: atomic.LoadInt64(&s.handshakes),
+		TLSFailures:   atomic.LoadInt64(&s.handshakeFails),
+		ProxyConnects: atomic.LoadInt64(&s.proxyConnects),
+		ProxyFailures: atomic.LoadInt64(&s.proxyFails),
+	}
+	if sum.TLSHandshakes > 0 {
+		sum.TLSHandshakeMs = toMillis(time.Duration(atomic.LoadInt64(&s.handshakeNanos) / sum.TLSHandshakes))
+	}
+	if sum.ProxyConnects > 0 {
+		sum.ProxyConnectMs = toMillis(time.Duration(atomic.LoadInt64(&s.proxyNanos) / sum.ProxyConnects))
+	}
+	return sum
+}
+
+func newTargetClient(conf clientConf) (targetClient, error) {
+	if conf.stats == nil {
+		conf.stats = &connStats{}
+	}
+	if conf.tlsConfig == nil {
+		conf.tlsConfig = &tls.Config{}
+	}
+	if conf.unixSocket != "" && conf.dialAddr != "" {
+		return nil, fmt.Errorf("a unix socket and a dial address can't be used together")
+	}
+	if conf.unixSocket != "" && conf.proxy != nil {
+		return nil, fmt.Errorf("a unix socket and a proxy can't be used together")
+	}
+	if conf.dialAddr != "" {
+		if _, _, err := net.SplitHostPort(conf.dialAddr); err != nil {
+			return nil, fmt.Errorf("invalid dial address %q: %v", conf.dialAddr, err)
+		}
+	}
+
+	opts := conf.options
+	switch conf.protocol {
+	case "", protocolHTTP1:
+		if forwardsRequests(conf.proxy, conf.target) {
+			if conf.dialAddr != "" {
+				return nil, fmt.Errorf("a dial address can't be used for http targets behind an HTTP proxy, which forwards requests itself")
+			}
+			return conf.forwardingClient(), nil
+		}
+		client := &fasthttp.Client{
+			MaxConnsPerHost:               opts.MaxConns,
+			ReadTimeout:                   opts.ReadTimeout,
+			WriteTimeout:                  opts.WriteTimeout,
+			MaxIdleConnDuration:           opts.MaxIdleConnDuration,
+			ReadBufferSize:                opts.ReadBufferSize,
+			WriteBufferSize:               opts.WriteBufferSize,
+			DisableHeaderNamesNormalizing: opts.NormalizeHeaders == nil || !*opts.NormalizeHeaders,
+			TLSConfig:                     conf.tlsConfig,
+			// fasthttp keeps a host client per scheme and host, so each one dials with the
+			// handshake its requests need, whatever the scheme of the target URL
+			ConfigureClient: func(hc *fasthttp.HostClient) error {
+				isTLS := hc.IsTLS
+				hc.Dial = func(addr string) (net.Conn, error) {
+					ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+					defer cancel()
+					return conf.dial(ctx, addr, isTLS, conf.tlsConfig)
+				}
+				return nil
+			},
+		}
+		if opts.KeepAlive != nil && !*opts.KeepAlive {
+			return &closingClient{client}, nil
+		}
+		return client, nil
+	case protocolH2:
+		h2TLS := conf.tlsConfig.Clone()
+		h2TLS.NextProtos = []string{http2.NextProtoTLS}
+		return &netHTTPClient{
+			client: &http.Client{
+				Transport: &http2.Transport{
+					DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+						return conf.dial(ctx, addr, true, h2TLS)
+					},
+				},
+				Timeout: opts.ReadTimeout + opts.WriteTimeout,
+			},
+		}, nil
+	case protocolH2C:
+		return &netHTTPClient{
+			client: &http.Client{
+				Transport: &http2.Transport{
+					AllowHTTP: true,
+					DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+						return conf.dial(ctx, addr, false, nil)
+					},
+				},
+				Timeout: opts.ReadTimeout + opts.WriteTimeout,
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown protocol: %q", conf.protocol)
+	}
+}
+
+// dialTarget opens a raw connection for addr. The unix socket or dial address overrides, when set,
+// replace where the connection goes while requests keep the host and URL of the target.
+// Connections are tunneled through the forward proxy if there is one.
+func (conf clientConf) dialTarget(ctx context.Context, addr string) (net.Conn, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	switch {
+	case conf.proxy != nil:
+		if conf.dialAddr != "" {
+			addr = conf.dialAddr
+		}
+		return conf.dialProxy(ctx, addr)
+	case conf.unixSocket != "":
+		return d.DialContext(ctx, "unix", conf.unixSocket)
+	case conf.dialAddr != "":
+		return d.DialContext(ctx, "tcp", conf.dialAddr)
+	default:
+		return d.DialContext(ctx, "tcp", addr)
+	}
+}
+
+// dial opens a connection to addr, performing and timing a TLS handshake when useTLS is set
+func (conf clientConf) dial(ctx context.Context, addr string, useTLS bool, tlsConfig *tls.Config) (net.Conn, error) {
+	conn, err := conf.dialTarget(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&conf.stats.dials, 1)
+	if !useTLS {
+		return conn, nil
+	}
+
+	cfg := tlsConfig.Clone()
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		cfg.ServerName = host
+	}
+	tlsConn := tls.Client(conn, cfg)
+	start := time.Now()
+	err = tlsConn.HandshakeContext(ctx)
+	atomic.AddInt64(&conf.stats.handshakeNanos, int64(time.Since(start)))
+	atomic.AddInt64(&conf.stats.handshakes, 1)
+	if err != nil {
+		atomic.AddInt64(&conf.stats.handshakeFails, 1)
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// closingClient sends every request with a "Connection: close" header, so connections are never reused
+type closingClient struct {
+	client *fasthttp.Client
+}
+
+func (c *closingClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	req.SetConnectionClose()
+	return c.client.Do(req, resp)
+}
+
+// netHTTPClient adapts a net/http client to the targetClient interface
+type netHTTPClient struct {
+	client *http.Client
+}
+
+func (c *netHTTPClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	var body io.Reader
+	if len(req.Body()) > 0 {
+		body = bytes.NewReader(req.Body())
+	}
+	httpReq, err := http.NewRequest(string(req.Header.Method()), req.URI().String(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.VisitAll(func(key, value []byte) {
+		switch string(key) {
+		case fasthttp.HeaderHost, fasthttp.HeaderContentLength, fasthttp.HeaderConnection:
+		default:
+			httpReq.Header.Add(string(key), string(value))
+		}
+	})
+	if host := req.Header.Host(); len(host) > 0 {
+		httpReq.Host = string(host)
+	}
+
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	resp.SetStatusCode(httpResp.StatusCode)
+	for key, values := range httpResp.Header {
+		for _, v := range values {
+			resp.Header.Add(key, v)
+		}
+	}
+	resp.SetBody(respBody)
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClientOptionsOver(t *testing.T) {
+	yes, no := true, false
+	base := clientOptions{
+		ReadTimeout:         time.Second,
+		WriteTimeout:        2 * time.Second,
+		MaxConns:            100,
+		KeepAlive:           &yes,
+		MaxIdleConnDuration: time.Minute,
+		ReadBufferSize:      4096,
+		WriteBufferSize:     8192,
+		NormalizeHeaders:    &yes,
+	}
+	tests := []struct {
+		name string
+		opts clientOptions
+		want clientOptions
+	}{
+		{name: "unset fields taken from base", opts: clientOptions{}, want: base},
+		{
+			name: "set fields kept",
+			opts: clientOptions{ReadTimeout: 5 * time.Second, MaxConns: 10, ReadBufferSize: 1024},
+			want: clientOptions{
+				ReadTimeout:         5 * time.Second,
+				WriteTimeout:        2 * time.Second,
+				MaxConns:            10,
+				KeepAlive:           &yes,
+				MaxIdleConnDuration: time.Minute,
+				ReadBufferSize:      1024,
+				WriteBufferSize:     8192,
+				NormalizeHeaders:    &yes,
+			},
+		},
+		{
+			name: "false booleans override true ones",
+			opts: clientOptions{KeepAlive: &no, NormalizeHeaders: &no},
+			want: clientOptions{
+				ReadTimeout:         time.Second,
+				WriteTimeout:        2 * time.Second,
+				MaxConns:            100,
+				KeepAlive:           &no,
+				MaxIdleConnDuration: time.Minute,
+				ReadBufferSize:      4096,
+				WriteBufferSize:     8192,
+				NormalizeHeaders:    &no,
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.over(base); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// an unset level in between leaves the run settings over the test ones
+	run := clientOptions{MaxConns: 5}
+	if got := run.over(clientOptions{}.over(base)); got.MaxConns != 5 || got.ReadTimeout != time.Second {
+		t.Errorf("chained over: got %+v", got)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// compareTolerances are the maximum changes allowed before a metric is flagged as a regression.
+// A zero or negative tolerance disables the check for that metric.
+type compareTolerances struct {
+	rpsDrop         float64 // percent
+	latencyIncrease float64 // percent
+	errorRate       float64 // percentage points
+	bytesChange     float64 // percent, either direction
+}
+
+type runKey struct {
+	test  string
+	runID string
+}
+
+// compareCommand implements "blowhole compare", returning the number of regressions found
+func compareCommand(args []string, out io.Writer) (int, error) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	tol := compareTolerances{}
+	fs.Float64Var(&tol.rpsDrop, "rps", 5, "float. Maximum drop in average RPS, in percent")
+	fs.Float64Var(&tol.latencyIncrease, "latency", 10, "float. Maximum increase in p50, p90 and p99 latencies, in percent")
+	fs.Float64Var(&tol.errorRate, "errors", 1, "float. Maximum increase in error rate, in percentage points")
+	fs.Float64Var(&tol.bytesChange, "bytes", 0, "float. Maximum change in bytes per request, in percent. Not checked if not set")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: blowhole compare [options] baseline.json candidate.json\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	baseline, err := readJSONResult(fs.Arg(0))
+	if err != nil {
+		return 0, err
+	}
+	candidate, err := readJSONResult(fs.Arg(1))
+	if err != nil {
+		return 0, err
+	}
+	return compareResults(baseline, candidate, tol, out), nil
+}
+
+func compareResults(baseline testResult, candidate testResult, tol compareTolerances, out io.Writer) int {
+	candidates := make(map[runKey]runResult)
+	for _, r := range candidate.Runs {
+		candidates[runKey{test: r.Test, runID: r.RunID}] = r
+	}
+
+	regressions := 0
+	seen := make(map[runKey]bool)
+	for _, b := range baseline.Runs {
+		key := runKey{test: b.Test, runID: b.RunID}
+		seen[key] = true
+		fmt.Fprintf(out, "%s\nTest \"%s\" - Run: %s\n", separator, b.Test, b.RunID)
+		c, ok := candidates[key]
+		if !ok {
+			fmt.Fprintln(out, "  Missing from candidate results  REGRESSION")
+			regressions++
+			continue
+		}
+		if c.Skipped != "" && b.Skipped == "" {
+			fmt.Fprintf(out, "  Skipped in candidate results: %s  REGRESSION\n", c.Skipped)
+			regressions++
+			continue
+		}
+		if b.Skipped != "" {
+			fmt.Fprintf(out, "  Skipped in baseline results: %s\n", b.Skipped)
+			continue
+		}
+		regressions += compareRuns(b, c, tol, out)
+	}
+	for _, c := range candidate.Runs {
+		if !seen[runKey{test: c.Test, runID: c.RunID}] {
+			fmt.Fprintf(out, "%s\nTest \"%s\" - Run: %s\n  Missing from baseline results\n", separator, c.Test, c.RunID)
+		}
+	}
+	fmt.Fprintln(out, separator)
+	fmt.Fprintf(out, "Regressions found: %d\n", regressions)
+	return regressions
+}
+
+func compareRuns(b runResult, c runResult, tol compareTolerances, out io.Writer) int {
+	regressions := 0
+	row := func(metric string, base float64, cand float64, delta string, regressed bool) {
+		marker := ""
+		if regressed {
+			marker = "  REGRESSION"
+			regressions++
+		}
+		fmt.Fprintf(out, "  %-16s %12.2f %12.2f %10s%s\n", metric, base, cand, delta, marker)
+	}
+	fmt.Fprintf(out, "  %-16s %12s %12s %10s\n", "metric", "baseline", "candidate", "delta")
+
+	rpsDelta := percentChange(b.RPS, c.RPS)
+	row("rps", b.RPS, c.RPS, fmt.Sprintf("%+.1f%%", rpsDelta), tol.rpsDrop > 0 && -rpsDelta > tol.rpsDrop)
+
+	for _, l := range []struct {
+		name string
+		base float64
+		cand float64
+	}{
+		{"p50 ms", b.Latency.P50, c.Latency.P50},
+		{"p90 ms", b.Latency.P90, c.Latency.P90},
+		{"p99 ms", b.Latency.P99, c.Latency.P99},
+	} {
+		delta := percentChange(l.base, l.cand)
+		row(l.name, l.base, l.cand, fmt.Sprintf("%+.1f%%", delta), tol.latencyIncrease > 0 && delta > tol.latencyIncrease)
+	}
+
+	baseErrors, candErrors := errorRate(b), errorRate(c)
+	row("error rate %", baseErrors, candErrors, fmt.Sprintf("%+.2fpp", candErrors-baseErrors),
+		tol.errorRate > 0 && candErrors-baseErrors > tol.errorRate)
+
+	baseBytes, candBytes := bytesPerRequest(b), bytesPerRequest(c)
+	bytesDelta := percentChange(baseBytes, candBytes)
+	row("bytes/request", baseBytes, candBytes, fmt.Sprintf("%+.1f%%", bytesDelta),
+		tol.bytesChange > 0 && (bytesDelta > tol.bytesChange || -bytesDelta > tol.bytesChange))
+
+	return regressions
+}
+
+func percentChange(base float64, cand float64) float64 {
+	if base == 0 {
+		if cand == 0 {
+			return 0
+		}
+		return 100
+	}
+	return (cand - base) / base * 100
+}
+
+// errorRate is the percentage of requests sent that failed or received a 5xx response
+func errorRate(r runResult) float64 {
+	if r.Sent == 0 {
+		return 0
+	}
+	return float64(r.Unsuccessful) / float64(r.Sent) * 100
+}
+
+func bytesPerRequest(r runResult) float64 {
+	if r.Sent == 0 {
+		return 0
+	}
+	return float64(r.BytesIn+r.BytesOut) / float64(r.Sent)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPercentChange(t *testing.T) {
+	tests := []struct {
+		base float64
+		cand float64
+		want float64
+	}{
+		{base: 100, cand: 110, want: 10},
+		{base: 100, cand: 80, want: -20},
+		{base: 50, cand: 50, want: 0},
+		{base: 0, cand: 0, want: 0},
+		{base: 0, cand: 5, want: 100},
+	}
+	for _, tt := range tests {
+		if got := percentChange(tt.base, tt.cand); got != tt.want {
+			t.Errorf("percentChange(%v, %v) = %v, want %v", tt.base, tt.cand, got, tt.want)
+		}
+	}
+}
+
+func TestCompareResults(t *testing.T) {
+	base := runResult{
+		Test:    "t",
+		RunID:   "RID001",
+		Sent:    1000,
+		RPS:     100,
+		Latency: latencySummary{P50: 10, P90: 20, P99: 40},
+		BytesIn: 100000,
+	}
+	tol := compareTolerances{rpsDrop: 5, latencyIncrease: 10, errorRate: 1, bytesChange: 20}
+	tests := []struct {
+		name      string
+		candidate func(r *runResult)
+		baseline  func(r *runResult)
+		want      int
+		wantText  string
+	}{
+		{name: "unchanged", candidate: func(r *runResult) {}, want: 0},
+		{name: "within tolerances", candidate: func(r *runResult) { r.RPS = 96; r.Latency.P99 = 43 }, want: 0},
+		{name: "rps drop", candidate: func(r *runResult) { r.RPS = 90 }, want: 1},
+		{name: "rps increase", candidate: func(r *runResult) { r.RPS = 200 }, want: 0},
+		{name: "latencies", candidate: func(r *runResult) { r.Latency = latencySummary{P50: 12, P90: 30, P99: 41} }, want: 2},
+		{name: "error rate", candidate: func(r *runResult) { r.Unsuccessful = 20 }, want: 1},
+		{name: "bytes either way", candidate: func(r *runResult) { r.BytesIn = 50000 }, want: 1},
+		{
+			name:      "skipped in candidate",
+			candidate: func(r *runResult) { r.Skipped = "hook failed" },
+			want:      1,
+			wantText:  "Skipped in candidate results: hook failed  REGRESSION",
+		},
+		{
+			name:      "skipped in baseline",
+			baseline:  func(r *runResult) { r.Skipped = "hook failed" },
+			candidate: func(r *runResult) { r.RPS = 1 },
+			want:      0,
+			wantText:  "Skipped in baseline results: hook failed",
+		},
+		{
+			name:      "missing from candidate",
+			candidate: func(r *runResult) { r.RunID = "RID002" },
+			want:      1,
+			wantText:  "Missing from candidate results  REGRESSION",
+		},
+	}
+	for _, tt := range tests {
+		b, c := base, base
+		if tt.baseline != nil {
+			tt.baseline(&b)
+		}
+		tt.candidate(&c)
+		var out strings.Builder
+		got := compareResults(testResult{Runs: []runResult{b}}, testResult{Runs: []runResult{c}}, tol, &out)
+		if got != tt.want {
+			t.Errorf("%s: got %d regressions, want %d\n%s", tt.name, got, tt.want, out.String())
+		}
+		if tt.wantText != "" && !strings.Contains(out.String(), tt.wantText) {
+			t.Errorf("%s: output does not contain %q\n%s", tt.name, tt.wantText, out.String())
+		}
+	}
+
+	// disabled tolerances are not checked
+	c := base
+	c.RPS, c.BytesIn = 1, 1
+	if got := compareResults(testResult{Runs: []runResult{base}}, testResult{Runs: []runResult{c}}, compareTolerances{}, io.Discard); got != 0 {
+		t.Errorf("got %d regressions with no tolerances, want 0", got)
+	}
+}
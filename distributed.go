@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"math"
 	"net"
@@ -112,6 +111,8 @@ func startDistributedWorker(params *testParams) {
 	wrkr.concurrency = int(respID.Concurrency)
 	wrkr.requests = int(respID.Requests)
 	wrkr.id = int(respID.WorkerID)
+	params.workerID = wrkr.id
+	params.idFormat = params.idFormat.widen(wrkr.concurrency, wrkr.requests)
 
 	wg := sync.WaitGroup{}
 	clientStats := distributed.NewStatsClient(con)
@@ -127,8 +128,18 @@ func startDistributedWorker(params *testParams) {
 			var respCodes []int64
 			defer wg.Done()
 			for i := 0; i < target; i++ {
-				reqID := fmt.Sprintf("%s.UID%05d.CID%06d", params.runID, userID, i)
-				respCode := sendRequest(params, reqID)
+				info := reqInfo{
+					id:     params.idFormat.build(params.runID, params.workerID, userID, i),
+					userID: userID,
+					count:  i,
+				}
+				respCode := sendRequest(params, info)
+				if params.rawLog != nil {
+					params.rawLog.log(params, respCode)
+				}
+				if params.metrics != nil {
+					params.metrics.observe(params.name, params.runID, respCode)
+				}
 				if len(respCodes) < 50 {
 					respCodes = append(respCodes, int64(respCode.code))
 				} else {
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Orders in which feeders hand out records
+const (
+	feedSequential string = "sequential"
+	feedRandom     string = "random"
+	feedCircular   string = "circular"
+	feedUnique     string = "unique"
+)
+
+// Scopes of feeder records: a new record for each request, or one record for each user
+const (
+	feedPerRequest string = "request"
+	feedPerUser    string = "user"
+)
+
+// Supported formats for feeder files
+const (
+	feedCSV   string = "csv"
+	feedJSONL string = "jsonl"
+)
+
+var errFeederExhausted = errors.New("feeder exhausted")
+
+// feederSpec is a file of records, such as user accounts or search terms, whose fields are exposed to
+// URL, header and body templates as variables named after them
+type feederSpec struct {
+	Name   string `yaml:"name"`
+	File   string `yaml:"file"`
+	Format string `yaml:"format"`
+	Order  string `yaml:"order"`
+	Per    string `yaml:"per"`
+}
+
+func (s feederSpec) label(i int) string {
+	if name := override(s.Name, s.File); name != "" {
+		return fmt.Sprintf("%q", name)
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// check returns a description of what's wrong with a feeder spec, if anything
+func (s feederSpec) check() string {
+	if s.File == "" {
+		return "feeders need a file"
+	}
+	switch s.format() {
+	case feedCSV, feedJSONL:
+	default:
+		return fmt.Sprintf("unknown feeder format: %q", s.Format)
+	}
+	switch s.Order {
+	case "", feedSequential, feedRandom, feedCircular, feedUnique:
+	default:
+		return fmt.Sprintf("unknown feeder order: %q", s.Order)
+	}
+	switch s.Per {
+	case "", feedPerRequest, feedPerUser:
+	default:
+		return fmt.Sprintf("unknown feeder scope: %q, expected request or user", s.Per)
+	}
+	return ""
+}
+
+func (s feederSpec) format() string {
+	if s.Format != "" {
+		return s.Format
+	}
+	if strings.EqualFold(filepath.Ext(s.File), ".csv") {
+		return feedCSV
+	}
+	return feedJSONL
+}
+
+// feeder hands out the records of a file to the requests or users of a run
+type feeder struct {
+	spec    feederSpec
+	records []map[string]string
+
+	mu        sync.Mutex
+	next      int
+	users     map[int]map[string]string
+	exhausted bool
+}
+
+func newFeeder(spec feederSpec) (*feeder, error) {
+	if msg := spec.check(); msg != "" {
+		return nil, errors.New(msg)
+	}
+	file, err := os.Open(spec.File)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	f := &feeder{spec: spec, users: make(map[int]map[string]string)}
+	if f.spec.Order == "" {
+		f.spec.Order = feedSequential
+	}
+	if f.spec.Per == "" {
+		f.spec.Per = feedPerRequest
+	}
+	if spec.format() == feedCSV {
+		f.records, err = readCSVRecords(file)
+	} else {
+		f.records, err = readJSONLRecords(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", spec.File, err)
+	}
+	if len(f.records) == 0 {
+		return nil, fmt.Errorf("%s: no records", spec.File)
+	}
+	return f, nil
+}
+
+func readCSVRecords(r io.Reader) ([]map[string]string, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	columns := rows[0]
+	for _, c := range columns {
+		if err := checkFeederField(c); err != nil {
+			return nil, err
+		}
+	}
+	records := make([]map[string]string, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := make(map[string]string, len(columns))
+		for i, c := range columns {
+			record[c] = row[i]
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// readJSONLRecords reads one JSON object per line. Values that aren't strings are kept as JSON.
+func readJSONLRecords(r io.Reader) ([]map[string]string, error) {
+	var records []map[string]string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(text), &fields); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		record := make(map[string]string, len(fields))
+		for k, raw := range fields {
+			if err := checkFeederField(k); err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			var s string
+			if err := json.Unmarshal(raw, &s); err == nil {
+				record[k] = s
+			} else {
+				record[k] = string(raw)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func checkFeederField(name string) error {
+	if !captureName.MatchString(name) || reservedVars[name] {
+		return fmt.Errorf("invalid field name for a template variable: %q", name)
+	}
+	return nil
+}
+
+// draw returns the record for a request. users is the number of users of the run, including the one
+// sending remainder requests, so sequential records are interleaved between users.
+func (f *feeder) draw(userID int, count int, users int) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.spec.Per == feedPerUser {
+		if record, ok := f.users[userID]; ok {
+			return record, nil
+		}
+		record, err := f.pick(userID)
+		if err != nil {
+			return nil, err
+		}
+		f.users[userID] = record
+		return record, nil
+	}
+	return f.pick(count*users + userID)
+}
+
+// pick returns a record in the feeder's order. position is used by the sequential order,
+// so the same requests or users get the same records in every run.
+func (f *feeder) pick(position int) (map[string]string, error) {
+	n := len(f.records)
+	switch f.spec.Order {
+	case feedRandom:
+		return f.records[rand.Intn(n)], nil
+	case feedCircular:
+		record := f.records[f.next%n]
+		f.next++
+		return record, nil
+	case feedUnique:
+		if f.next >= n {
+			if !f.exhausted {
+				f.exhausted = true
+				fmt.Printf("\nFeeder %q exhausted after %d records, users stop sending requests\n", override(f.spec.Name, f.spec.File), n)
+			}
+			return nil, errFeederExhausted
+		}
+		record := f.records[f.next]
+		f.next++
+		return record, nil
+	default:
+		return f.records[position%n], nil
+	}
+}
+
+// newReqInfo builds the ids of a request and draws its records from the feeders of the run
+func newReqInfo(params *testParams, userID int, count int) (reqInfo, error) {
+	info := reqInfo{
+		id:     params.idFormat.build(params.runID, params.workerID, userID, count),
+		userID: userID,
+		count:  count,
+	}
+	if len(params.feeders) == 0 {
+		return info, nil
+	}
+	info.vars = make(map[string]string)
+	for _, f := range params.feeders {
+		record, err := f.draw(userID, count, params.concurrentUsers+1)
+		if err != nil {
+			return info, err
+		}
+		for k, v := range record {
+			info.vars[k] = v
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testFeeder(order string, per string, n int) *feeder {
+	f := &feeder{
+		spec:  feederSpec{Name: "test", Order: order, Per: per},
+		users: make(map[int]map[string]string),
+	}
+	for i := 0; i < n; i++ {
+		f.records = append(f.records, map[string]string{"n": string(rune('a' + i))})
+	}
+	return f
+}
+
+// drawAll draws records for the given (userID, count) pairs, returning their "n" fields,
+// or "!" once the feeder is exhausted
+func drawAll(f *feeder, users int, draws [][2]int) string {
+	var out []string
+	for _, d := range draws {
+		record, err := f.draw(d[0], d[1], users)
+		if err != nil {
+			out = append(out, "!")
+			continue
+		}
+		out = append(out, record["n"])
+	}
+	return strings.Join(out, "")
+}
+
+func TestFeederDraw(t *testing.T) {
+	// two users and the remainder user, each sending requests 0 and 1
+	draws := [][2]int{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {1, 1}, {2, 1}}
+	tests := []struct {
+		name  string
+		order string
+		per   string
+		n     int
+		want  string
+	}{
+		{name: "sequential per request", order: feedSequential, per: feedPerRequest, n: 10, want: "abcdef"},
+		{name: "sequential wraps around", order: feedSequential, per: feedPerRequest, n: 4, want: "abcdab"},
+		{name: "sequential per user", order: feedSequential, per: feedPerUser, n: 10, want: "abcabc"},
+		{name: "circular", order: feedCircular, per: feedPerRequest, n: 4, want: "abcdab"},
+		{name: "circular per user", order: feedCircular, per: feedPerUser, n: 2, want: "abaaba"},
+		{name: "unique", order: feedUnique, per: feedPerRequest, n: 4, want: "abcd!!"},
+		{name: "unique per user", order: feedUnique, per: feedPerUser, n: 2, want: "ab!ab!"},
+	}
+	for _, tt := range tests {
+		f := testFeeder(tt.order, tt.per, tt.n)
+		if got := drawAll(f, 3, draws); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFeederDrawRandom(t *testing.T) {
+	f := testFeeder(feedRandom, feedPerRequest, 3)
+	for i := 0; i < 100; i++ {
+		record, err := f.draw(0, i, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := record["n"]; n < "a" || n > "c" {
+			t.Fatalf("unexpected record %v", record)
+		}
+	}
+}
+
+func TestReadFeederRecords(t *testing.T) {
+	csvRecords, err := readCSVRecords(strings.NewReader("email,password\na@x.io,one\nb@x.io,\"t,wo\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{{"email": "a@x.io", "password": "one"}, {"email": "b@x.io", "password": "t,wo"}}
+	if !reflect.DeepEqual(csvRecords, want) {
+		t.Errorf("csv: got %v, want %v", csvRecords, want)
+	}
+
+	jsonRecords, err := readJSONLRecords(strings.NewReader("{\"term\": \"shoes\", \"ids\": [1, 2]}\n\n{\"term\": \"hats\", \"n\": 3}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []map[string]string{{"term": "shoes", "ids": "[1, 2]"}, {"term": "hats", "n": "3"}}
+	if !reflect.DeepEqual(jsonRecords, want) {
+		t.Errorf("jsonl: got %v, want %v", jsonRecords, want)
+	}
+
+	for _, text := range []string{"ID,email\n1,a\n", "bad-name\n1\n"} {
+		if _, err := readCSVRecords(strings.NewReader(text)); err == nil {
+			t.Errorf("csv %q: expected an error for an invalid field name", text)
+		}
+	}
+	if _, err := readJSONLRecords(strings.NewReader("{\"a\": 1}\nnot json\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("jsonl: got error %v, want an error on line 2", err)
+	}
+}
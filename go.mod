@@ -3,8 +3,10 @@ module github.com/resurfaceio/blowhole
 go 1.20
 
 require (
+	github.com/gorilla/websocket v1.5.0
 	github.com/schollz/progressbar/v3 v3.13.1
 	github.com/valyala/fasthttp v1.48.0
+	golang.org/x/net v0.9.0
 	google.golang.org/grpc v1.57.0
 	google.golang.org/protobuf v1.31.0
 	gopkg.in/yaml.v3 v3.0.1
@@ -18,7 +20,6 @@ require (
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	golang.org/x/net v0.9.0 // indirect
 	golang.org/x/sys v0.7.0 // indirect
 	golang.org/x/term v0.7.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
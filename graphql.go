@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+const runGraphQL string = "graphql"
+
+var graphqlOperationName = regexp.MustCompile(`\b(?:query|mutation|subscription)\s+([_A-Za-z][_0-9A-Za-z]*)`)
+
+// graphqlTarget builds GraphQL requests from a query document, a variables template and an operation name
+type graphqlTarget struct {
+	query     string
+	operation *requestTemplate
+	variables *requestTemplate
+}
+
+type graphqlRequest struct {
+	Query         string          `json:"query"`
+	Variables     json.RawMessage `json:"variables,omitempty"`
+	OperationName string          `json:"operationName,omitempty"`
+}
+
+type graphqlResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func newGraphQLTarget(queryFile string, variables string, operation string) (*graphqlTarget, error) {
+	if queryFile == "" {
+		return nil, fmt.Errorf("a query document file is required for GraphQL runs")
+	}
+	query, err := os.ReadFile(queryFile)
+	if err != nil {
+		return nil, err
+	}
+	t := &graphqlTarget{query: string(query)}
+	if t.variables, err = newRequestTemplate("graphql variables", variables); err != nil {
+		return nil, err
+	}
+	if t.operation, err = newRequestTemplate("graphql operation", operation); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// body returns the JSON request body and the operation name used to group stats
+func (t *graphqlTarget) body(vars map[string]string) ([]byte, string, error) {
+	req := graphqlRequest{Query: t.query}
+
+	variables, err := t.variables.render(vars)
+	if err != nil {
+		return nil, "", err
+	}
+	if variables != "" {
+		if !json.Valid([]byte(variables)) {
+			return nil, "", fmt.Errorf("Error: GraphQL variables are not valid JSON: %s", variables)
+		}
+		req.Variables = json.RawMessage(variables)
+	}
+
+	if req.OperationName, err = t.operation.render(vars); err != nil {
+		return nil, "", err
+	}
+	label := req.OperationName
+	if label == "" {
+		label = "anonymous"
+		if m := graphqlOperationName.FindStringSubmatch(t.query); m != nil {
+			label = m[1]
+		}
+	}
+
+	body, err := json.Marshal(req)
+	return body, label, err
+}
+
+// responseError returns a description of the GraphQL errors in a response body, if any
+func (t *graphqlTarget) responseError(body []byte) string {
+	var resp graphqlResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "Error: invalid GraphQL response"
+	}
+	if len(resp.Errors) == 0 {
+		return ""
+	}
+	return "GraphQL error: " + resp.Errors[0].Message
+}
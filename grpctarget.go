@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Supported run types
+const (
+	runHTTP string = "http"
+	runGRPC string = "grpc"
+)
+
+// grpcTarget sends unary requests to a gRPC method described by a descriptor set or by server reflection
+type grpcTarget struct {
+	conn    *grpc.ClientConn
+	method  string
+	input   protoreflect.MessageDescriptor
+	output  protoreflect.MessageDescriptor
+	body    *requestTemplate
+	timeout time.Duration
+}
+
+type grpcOptions struct {
+	target    string
+	method    string
+	protoSet  string
+	body      string
+	timeout   time.Duration
+	tlsConfig *tls.Config
+	dial      dialFunc
+}
+
+// grpcToHTTP maps gRPC status codes to their HTTP equivalents, so gRPC runs share HTTP stats
+var grpcToHTTP = map[codes.Code]int{
+	codes.OK:                 200,
+	codes.Canceled:           499,
+	codes.Unknown:            500,
+	codes.InvalidArgument:    400,
+	codes.DeadlineExceeded:   504,
+	codes.NotFound:           404,
+	codes.AlreadyExists:      409,
+	codes.PermissionDenied:   403,
+	codes.ResourceExhausted:  429,
+	codes.FailedPrecondition: 400,
+	codes.Aborted:            409,
+	codes.OutOfRange:         400,
+	codes.Unimplemented:      501,
+	codes.Internal:           500,
+	codes.Unavailable:        503,
+	codes.DataLoss:           500,
+	codes.Unauthenticated:    401,
+}
+
+func newGRPCTarget(opts grpcOptions) (*grpcTarget, error) {
+	addr, useTLS, err := grpcAddress(opts.target)
+	if err != nil {
+		return nil, err
+	}
+	service, method, err := splitGRPCMethod(opts.method)
+	if err != nil {
+		return nil, err
+	}
+	body, err := newRequestTemplate("grpc body", override(opts.body, "{}"))
+	if err != nil {
+		return nil, err
+	}
+
+	creds := insecure.NewCredentials()
+	if useTLS {
+		creds = credentials.NewTLS(opts.tlsConfig.Clone())
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds), grpc.WithContextDialer(opts.dial))
+	if err != nil {
+		return nil, err
+	}
+	methodDesc, err := findGRPCMethod(conn, opts.protoSet, service, method)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &grpcTarget{
+		conn:    conn,
+		method:  "/" + service + "/" + method,
+		input:   methodDesc.Input(),
+		output:  methodDesc.Output(),
+		body:    body,
+		timeout: opts.timeout,
+	}, nil
+}
+
+// findGRPCMethod looks up a unary method in a descriptor set if there is one, or with server reflection
+func findGRPCMethod(conn *grpc.ClientConn, protoSet string, service string, method string) (protoreflect.MethodDescriptor, error) {
+	var files *protoregistry.Files
+	var err error
+	if protoSet != "" {
+		files, err = filesFromDescriptorSet(protoSet)
+	} else {
+		files, err = filesFromReflection(conn, service)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found: %w", service, err)
+	}
+	serviceDesc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	methodDesc := serviceDesc.Methods().ByName(protoreflect.Name(method))
+	if methodDesc == nil {
+		return nil, fmt.Errorf("method %s not found in service %s", method, service)
+	}
+	if methodDesc.IsStreamingClient() || methodDesc.IsStreamingServer() {
+		return nil, fmt.Errorf("streaming method %s/%s is not supported", service, method)
+	}
+	return methodDesc, nil
+}
+
+// close closes the connection to the target once the run is over
+func (g *grpcTarget) close() error {
+	return g.conn.Close()
+}
+
+// grpcAddress accepts grpc://host:port, grpcs://host:port (TLS) or a bare host:port
+func grpcAddress(target string) (string, bool, error) {
+	if !strings.Contains(target, "://") {
+		return target, false, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", false, err
+	}
+	switch u.Scheme {
+	case "grpc", "http":
+		return u.Host, false, nil
+	case "grpcs", "https":
+		return u.Host, true, nil
+	default:
+		return "", false, fmt.Errorf("unsupported scheme for gRPC target: %q", u.Scheme)
+	}
+}
+
+// splitGRPCMethod accepts package.Service/Method, /package.Service/Method or package.Service.Method
+func splitGRPCMethod(fullMethod string) (string, string, error) {
+	m := strings.TrimPrefix(fullMethod, "/")
+	i := strings.LastIndex(m, "/")
+	if i < 0 {
+		i = strings.LastIndex(m, ".")
+	}
+	if i <= 0 || i == len(m)-1 {
+		return "", "", fmt.Errorf("invalid gRPC method name: %q", fullMethod)
+	}
+	return m[:i], m[i+1:], nil
+}
+
+func filesFromDescriptorSet(path string) (*protoregistry.Files, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing descriptor set: %w", err)
+	}
+	return protodesc.NewFiles(&set)
+}
+
+func filesFromReflection(conn *grpc.ClientConn, service string) (*protoregistry.Files, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("server reflection: %w", err)
+	}
+	defer stream.CloseSend()
+
+	set := &descriptorpb.FileDescriptorSet{}
+	loaded := make(map[string]bool)
+	request := &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	}
+	var pending []string
+	for request != nil {
+		if err := stream.Send(request); err != nil {
+			return nil, fmt.Errorf("server reflection: %w", err)
+		}
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("server reflection: %w", err)
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf("server reflection: %s", e.ErrorMessage)
+		}
+		for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(raw, fd); err != nil {
+				return nil, fmt.Errorf("server reflection: %w", err)
+			}
+			if loaded[fd.GetName()] {
+				continue
+			}
+			loaded[fd.GetName()] = true
+			set.File = append(set.File, fd)
+			pending = append(pending, fd.GetDependency()...)
+		}
+
+		request = nil
+		for len(pending) > 0 && request == nil {
+			dep := pending[0]
+			pending = pending[1:]
+			if !loaded[dep] {
+				request = &rpb.ServerReflectionRequest{
+					MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+				}
+			}
+		}
+	}
+	return protodesc.NewFiles(set)
+}
+
+func (g *grpcTarget) send(params *testParams, info reqInfo) (res respStatus) {
+	res.id = info.id
+	res.endpoint = params.url + g.method
+
+	body, err := g.body.render(templateVars(params, info))
+	if err != nil {
+		res.code = -1
+		res.err = err.Error()
+		return
+	}
+	req := dynamicpb.NewMessage(g.input)
+	if err := protojson.Unmarshal([]byte(body), req); err != nil {
+		res.code = -1
+		res.err = "Error: invalid request message: " + err.Error()
+		return
+	}
+	resp := dynamicpb.NewMessage(g.output)
+
+	md := metadata.Pairs(strings.ToLower(params.idName), info.id)
+	if err := renderHeaders(params, info, func(name string, value string) {
+		md.Set(strings.ToLower(name), value)
+	}); err != nil {
+		res.code = -1
+		res.err = err.Error()
+		return
+	}
+	if params.trace.enabled() {
+		var spanID string
+		res.traceID, spanID = traceIDs(params.runID, params.workerID, info.userID, info.count)
+		for _, h := range params.trace.headers(res.traceID, spanID) {
+			md.Append(strings.ToLower(h[0]), h[1])
+		}
+	}
+	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	res.bytesOut = proto.Size(req)
+	if params.metrics != nil {
+		params.metrics.requestSent(params.name, params.runID)
+		defer params.metrics.requestFinished(params.name, params.runID)
+	}
+	res.start = time.Now()
+	err = g.conn.Invoke(ctx, g.method, req, resp)
+	res.latency = time.Since(res.start)
+
+	st := status.Convert(err)
+	res.grpcStatus = st.Code().String()
+	res.code = grpcToHTTP[st.Code()]
+	if st.Code() != codes.OK {
+		res.err = st.Code().String() + ": " + st.Message()
+	} else {
+		res.bytesIn = proto.Size(resp)
+	}
+	return
+}
+
+func formatGRPCCodes(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %d", name, counts[name]))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, " | ")
+}
@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestGRPCAddress(t *testing.T) {
+	tests := []struct {
+		target  string
+		addr    string
+		useTLS  bool
+		wantErr bool
+	}{
+		{target: "localhost:50051", addr: "localhost:50051"},
+		{target: "grpc://localhost:50051", addr: "localhost:50051"},
+		{target: "http://localhost:50051/", addr: "localhost:50051"},
+		{target: "grpcs://api.example.com:443", addr: "api.example.com:443", useTLS: true},
+		{target: "https://api.example.com", addr: "api.example.com", useTLS: true},
+		{target: "ws://localhost:50051", wantErr: true},
+		{target: "grpc://bad host", wantErr: true},
+	}
+	for _, tt := range tests {
+		addr, useTLS, err := grpcAddress(tt.target)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("grpcAddress(%q): expected an error", tt.target)
+			}
+			continue
+		}
+		if err != nil || addr != tt.addr || useTLS != tt.useTLS {
+			t.Errorf("grpcAddress(%q) = %q, %v (%v), want %q, %v", tt.target, addr, useTLS, err, tt.addr, tt.useTLS)
+		}
+	}
+}
+
+func TestSplitGRPCMethod(t *testing.T) {
+	tests := []struct {
+		method  string
+		service string
+		name    string
+		wantErr bool
+	}{
+		{method: "grpc.health.v1.Health/Check", service: "grpc.health.v1.Health", name: "Check"},
+		{method: "/grpc.health.v1.Health/Check", service: "grpc.health.v1.Health", name: "Check"},
+		{method: "grpc.health.v1.Health.Check", service: "grpc.health.v1.Health", name: "Check"},
+		{method: "Health/Check", service: "Health", name: "Check"},
+		{method: "Check", wantErr: true},
+		{method: "Health/", wantErr: true},
+		{method: "/Check", wantErr: true},
+		{method: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		service, name, err := splitGRPCMethod(tt.method)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("splitGRPCMethod(%q): expected an error", tt.method)
+			}
+			continue
+		}
+		if err != nil || service != tt.service || name != tt.name {
+			t.Errorf("splitGRPCMethod(%q) = %q, %q (%v), want %q, %q", tt.method, service, name, err, tt.service, tt.name)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// hookSpec is a setup or teardown step around a test or a run: a shell command or an HTTP request.
+// Strings in HTTP hooks are templates that can use variables captured by earlier hooks, e.g. {{.TOKEN}}.
+// Commands aren't templated, as captured values would be read by the shell: they get variables from
+// the environment instead, e.g. "$TOKEN".
+type hookSpec struct {
+	Name    string        `yaml:"name"`
+	Run     string        `yaml:"run"`
+	HTTP    *hookRequest  `yaml:"http"`
+	Capture string        `yaml:"capture"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type hookRequest struct {
+	Method       string            `yaml:"method"`
+	URL          string            `yaml:"url"`
+	Headers      map[string]string `yaml:"headers"`
+	Body         string            `yaml:"body"`
+	ExpectStatus int               `yaml:"expect_status"`
+}
+
+// defaultHookTimeout keeps a hung hook from blocking a test forever
+const defaultHookTimeout = 5 * time.Minute
+
+var captureName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedVars are the template variables set for each request, which captures can't replace
+var reservedVars = map[string]bool{"ID": true, "RID": true, "UID": true, "CID": true, "WID": true}
+
+func (h hookSpec) label(i int) string {
+	if h.Name != "" {
+		return fmt.Sprintf("%q", h.Name)
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// check returns a description of what's wrong with a hook, if anything
+func (h hookSpec) check() string {
+	if (h.Run == "") == (h.HTTP == nil) {
+		return "hooks need either a run command or an http request"
+	}
+	if h.HTTP != nil && h.HTTP.URL == "" {
+		return "http hooks need a url"
+	}
+	if strings.Contains(h.Run, "{{") {
+		return "run commands can't use templates, read captured variables from the environment instead, e.g. \"$TOKEN\""
+	}
+	if h.Timeout < 0 {
+		return "timeout can't be negative"
+	}
+	if h.Capture != "" && (!captureName.MatchString(h.Capture) || reservedVars[h.Capture]) {
+		return fmt.Sprintf("invalid capture variable name: %q", h.Capture)
+	}
+	return ""
+}
+
+// runHooks runs hooks in order, adding captured outputs to vars. It stops at the first failing hook.
+func runHooks(stage string, hooks []hookSpec, vars map[string]string, tlsConfig *tls.Config) error {
+	for i, h := range hooks {
+		start := time.Now()
+		output, err := h.execute(vars, tlsConfig)
+		if err != nil {
+			fmt.Printf("Hook %s (%s): failed after %.0f ms: %v\n", h.label(i), stage, toMillis(time.Since(start)), err)
+			return fmt.Errorf("hook %s (%s) failed: %v", h.label(i), stage, err)
+		}
+		fmt.Printf("Hook %s (%s): done in %.0f ms\n", h.label(i), stage, toMillis(time.Since(start)))
+		if h.Capture != "" {
+			vars[h.Capture] = strings.TrimSpace(output)
+		}
+	}
+	return nil
+}
+
+func (h hookSpec) execute(vars map[string]string, tlsConfig *tls.Config) (string, error) {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if h.HTTP != nil {
+		return h.HTTP.send(ctx, vars, tlsConfig)
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.Run)
+	// don't wait for processes started by the command that keep its output open after a timeout
+	cmd.WaitDelay = time.Second
+	cmd.Env = os.Environ()
+	for k, v := range vars {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("timed out after %s", timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%v: %s", err, msg)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+func (r *hookRequest) send(ctx context.Context, vars map[string]string, tlsConfig *tls.Config) (string, error) {
+	url, err := renderHookText("url", r.URL, vars)
+	if err != nil {
+		return "", err
+	}
+	body, err := renderHookText("body", r.Body, vars)
+	if err != nil {
+		return "", err
+	}
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+		if body != "" {
+			method = http.MethodPost
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), url, strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	for name, value := range r.Headers {
+		if value, err = renderHookText("header "+name, value, vars); err != nil {
+			return "", err
+		}
+		req.Header.Set(name, value)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig.Clone(), Proxy: http.ProxyFromEnvironment}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if r.ExpectStatus != 0 && resp.StatusCode != r.ExpectStatus {
+		return "", fmt.Errorf("expected status %d, got %d", r.ExpectStatus, resp.StatusCode)
+	}
+	if r.ExpectStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return string(respBody), nil
+}
+
+func renderHookText(name string, text string, vars map[string]string) (string, error) {
+	t, err := newRequestTemplate("hook "+name, text)
+	if err != nil {
+		return "", err
+	}
+	return t.render(vars)
+}
+
+// copyVars returns a copy of captured variables, so run-level captures don't leak into other runs
+func copyVars(vars map[string]string) map[string]string {
+	c := make(map[string]string, len(vars))
+	for k, v := range vars {
+		c[k] = v
+	}
+	return c
+}
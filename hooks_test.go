@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHookCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		hook    hookSpec
+		wantErr string
+	}{
+		{name: "command", hook: hookSpec{Run: "echo ok", Capture: "TOKEN"}},
+		{name: "http request", hook: hookSpec{HTTP: &hookRequest{URL: "http://target/login"}, Capture: "_token2"}},
+		{name: "neither", hook: hookSpec{}, wantErr: "either a run command or an http request"},
+		{name: "both", hook: hookSpec{Run: "true", HTTP: &hookRequest{URL: "http://x/"}}, wantErr: "either a run command or an http request"},
+		{name: "no url", hook: hookSpec{HTTP: &hookRequest{}}, wantErr: "http hooks need a url"},
+		{name: "templated command", hook: hookSpec{Run: "curl -H 'Authorization: {{.TOKEN}}'"}, wantErr: "run commands can't use templates"},
+		{name: "negative timeout", hook: hookSpec{Run: "true", Timeout: -time.Second}, wantErr: "timeout can't be negative"},
+		{name: "invalid capture", hook: hookSpec{Run: "true", Capture: "MY-TOKEN"}, wantErr: "invalid capture variable name"},
+		{name: "reserved capture", hook: hookSpec{Run: "true", Capture: "CID"}, wantErr: "invalid capture variable name"},
+	}
+	for _, tt := range tests {
+		got := tt.hook.check()
+		if tt.wantErr == "" && got != "" || !strings.Contains(got, tt.wantErr) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.wantErr)
+		}
+	}
+}
+
+func TestRunHooksCapture(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/login":
+			io.WriteString(w, "  tok-"+string(body)+"\n")
+		case "/me":
+			io.WriteString(w, r.Method+" "+r.Header.Get("Authorization"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	vars := map[string]string{"USER": "ann"}
+	hooks := []hookSpec{
+		{Name: "login", HTTP: &hookRequest{URL: server.URL + "/login", Body: "{{.USER}}"}, Capture: "TOKEN"},
+		{Name: "me", HTTP: &hookRequest{URL: server.URL + "/me", Headers: map[string]string{"Authorization": "Bearer {{.TOKEN}}"}}, Capture: "ME"},
+		{Name: "env", Run: `printf '%s/%s' "$USER" "$TOKEN"`, Capture: "ENV"},
+	}
+	if err := runHooks("before test", hooks, vars, nil); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{"TOKEN": "tok-ann", "ME": "GET Bearer tok-ann", "ENV": "ann/tok-ann"} {
+		if vars[k] != want {
+			t.Errorf("%s = %q, want %q", k, vars[k], want)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		hook    hookSpec
+		wantErr string
+	}{
+		{name: "unexpected status", hook: hookSpec{HTTP: &hookRequest{URL: server.URL + "/nope"}}, wantErr: "unexpected status 404"},
+		{name: "expected status", hook: hookSpec{HTTP: &hookRequest{URL: server.URL + "/me", ExpectStatus: 201}}, wantErr: "expected status 201, got 200"},
+		{name: "failing command", hook: hookSpec{Run: "echo broken >&2; exit 3"}, wantErr: "exit status 3: broken"},
+		{name: "timeout", hook: hookSpec{Run: "sleep 5", Timeout: 100 * time.Millisecond}, wantErr: "timed out after 100ms"},
+	}
+	for _, tt := range tests {
+		vars := map[string]string{}
+		err := runHooks("after run", []hookSpec{tt.hook, {Run: "true", Capture: "NEXT"}}, vars, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.wantErr)
+		}
+		if _, ok := vars["NEXT"]; ok {
+			t.Errorf("%s: hooks after a failing one were run", tt.name)
+		}
+	}
+}
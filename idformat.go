@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Where the unique id is placed in each request
+const (
+	idInHeader string = "header"
+	idInQuery  string = "query"
+	idInBody   string = "body"
+)
+
+const defaultIDFormat string = "{RID}.UID{UID:5}.CID{CID:6}"
+
+type idSegment struct {
+	literal string
+	field   string
+	width   int
+}
+
+// idFormat is a pre-parsed id template. Placeholders are written as {FIELD} or {FIELD:width},
+// where FIELD is one of RID, UID, CID, WID or TS (unix time in milliseconds) and width is
+// the minimum number of digits, zero-padded.
+type idFormat struct {
+	segments []idSegment
+}
+
+func parseIDFormat(format string) (*idFormat, error) {
+	f := &idFormat{}
+	for len(format) > 0 {
+		start := strings.IndexByte(format, '{')
+		if start < 0 {
+			f.segments = append(f.segments, idSegment{literal: format})
+			break
+		}
+		if start > 0 {
+			f.segments = append(f.segments, idSegment{literal: format[:start]})
+		}
+		end := strings.IndexByte(format[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed placeholder in id format: %q", format[start:])
+		}
+		seg := idSegment{}
+		field, width, hasWidth := strings.Cut(format[start+1:start+end], ":")
+		seg.field = strings.ToUpper(field)
+		switch seg.field {
+		case "RID", "UID", "CID", "WID", "TS":
+		default:
+			return nil, fmt.Errorf("unknown placeholder in id format: {%s}", field)
+		}
+		if hasWidth {
+			w, err := strconv.Atoi(width)
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("invalid width for placeholder {%s}: %q", field, width)
+			}
+			seg.width = w
+		}
+		f.segments = append(f.segments, seg)
+		format = format[start+end+1:]
+	}
+	return f, nil
+}
+
+// widen returns a copy of the format where UID and CID widths fit every value
+// in a run, so ids keep a fixed width past 99,999 users or 999,999 requests.
+func (f *idFormat) widen(users int, requestsPerUser int) *idFormat {
+	wide := &idFormat{segments: make([]idSegment, len(f.segments))}
+	copy(wide.segments, f.segments)
+	for i, seg := range wide.segments {
+		digits := 0
+		switch {
+		case seg.field == "UID" && seg.width > 0:
+			digits = len(strconv.Itoa(users))
+		case seg.field == "CID" && seg.width > 0:
+			digits = len(strconv.Itoa(requestsPerUser))
+		}
+		if digits > seg.width {
+			wide.segments[i].width = digits
+		}
+	}
+	return wide
+}
+
+// largestShare returns the most requests any user sends when requests are split between users,
+// counting the extra user that sends the remainder
+func largestShare(requests int, users int) int {
+	if users <= 0 {
+		return requests
+	}
+	if requests%users > requests/users {
+		return requests % users
+	}
+	return requests / users
+}
+
+func (f *idFormat) build(runID string, workerID int, userID int, count int) string {
+	var sb strings.Builder
+	for _, seg := range f.segments {
+		switch seg.field {
+		case "":
+			sb.WriteString(seg.literal)
+		case "RID":
+			sb.WriteString(runID)
+		case "UID":
+			writePadded(&sb, int64(userID), seg.width)
+		case "CID":
+			writePadded(&sb, int64(count), seg.width)
+		case "WID":
+			writePadded(&sb, int64(workerID), seg.width)
+		case "TS":
+			writePadded(&sb, time.Now().UnixMilli(), seg.width)
+		}
+	}
+	return sb.String()
+}
+
+func writePadded(sb *strings.Builder, n int64, width int) {
+	s := strconv.FormatInt(n, 10)
+	for i := len(s); i < width; i++ {
+		sb.WriteByte('0')
+	}
+	sb.WriteString(s)
+}
+
+// idBody returns a JSON object with a single field holding the id
+func idBody(name string, id string) []byte {
+	body, _ := json.Marshal(map[string]string{name: id})
+	return body
+}
@@ -0,0 +1,85 @@
+package main
+
+import "testing"
+
+func TestParseIDFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{format: defaultIDFormat, want: "RID001.UID00003.CID000042"},
+		{format: "{rid}-{WID:2}-{UID}-{CID}", want: "RID001-07-3-42"},
+		{format: "req-{CID:1}", want: "req-42"},
+		{format: "fixed", want: "fixed"},
+		{format: "{RID", wantErr: true},
+		{format: "{FOO}", wantErr: true},
+		{format: "{UID:x}", wantErr: true},
+		{format: "{UID:-1}", wantErr: true},
+	}
+	for _, tt := range tests {
+		f, err := parseIDFormat(tt.format)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseIDFormat(%q): expected an error", tt.format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseIDFormat(%q): %v", tt.format, err)
+			continue
+		}
+		if got := f.build("RID001", 7, 3, 42); got != tt.want {
+			t.Errorf("parseIDFormat(%q).build() = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestIDFormatWiden(t *testing.T) {
+	tests := []struct {
+		format          string
+		users           int
+		requestsPerUser int
+		want            string
+	}{
+		{format: defaultIDFormat, users: 10, requestsPerUser: 100, want: "R.UID00003.CID000042"},
+		{format: defaultIDFormat, users: 100000, requestsPerUser: 100, want: "R.UID000003.CID000042"},
+		{format: defaultIDFormat, users: 10, requestsPerUser: 1000000, want: "R.UID00003.CID0000042"},
+		// placeholders without a width are left as they are
+		{format: "{UID}.{CID}", users: 100000, requestsPerUser: 1000000, want: "3.42"},
+	}
+	for _, tt := range tests {
+		f, err := parseIDFormat(tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := f.build("R", 0, 3, 42)
+		if got := f.widen(tt.users, tt.requestsPerUser).build("R", 0, 3, 42); got != tt.want {
+			t.Errorf("widen(%d, %d) of %q = %q, want %q", tt.users, tt.requestsPerUser, tt.format, got, tt.want)
+		}
+		if after := f.build("R", 0, 3, 42); after != before {
+			t.Errorf("widen modified the original format: %q, was %q", after, before)
+		}
+	}
+}
+
+func TestLargestShare(t *testing.T) {
+	tests := []struct {
+		requests int
+		users    int
+		want     int
+	}{
+		{requests: 100, users: 10, want: 10},
+		{requests: 105, users: 10, want: 10},
+		{requests: 19, users: 10, want: 9},
+		// fewer requests than users: the remainder user sends them all
+		{requests: 5, users: 10, want: 5},
+		{requests: 0, users: 10, want: 0},
+		{requests: 7, users: 0, want: 7},
+	}
+	for _, tt := range tests {
+		if got := largestShare(tt.requests, tt.users); got != tt.want {
+			t.Errorf("largestShare(%d, %d) = %d, want %d", tt.requests, tt.users, got, tt.want)
+		}
+	}
+}
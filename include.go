@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadSpecFile reads a batch file, expands variables in its values and merges the files it includes under it, in order.
+// Included paths are relative to the including file. files records the file each node comes from, so errors
+// point at the right file, and stack holds the files being loaded, to catch include cycles.
+func loadSpecFile(filename string, vars map[string]string, files map[*yaml.Node]string, stack []string) (*yaml.Node, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range stack {
+		if f == abs {
+			return nil, fmt.Errorf("%s: include cycle: %s", filename, strings.Join(append(stack, abs), " -> "))
+		}
+	}
+
+	fileBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(fileBytes, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("%s: empty batch file", filename)
+	}
+	if err := expandVariables(&doc, vars); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	var probe batchSpec
+	if err := decodeStrict(doc.Content[0], &probe); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	root := doc.Content[0]
+	markFile(root, filename, files)
+
+	var merged *yaml.Node
+	for _, inc := range probe.Include {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(filename), inc)
+		}
+		node, err := loadSpecFile(inc, vars, files, append(stack, abs))
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeNodes(merged, node, files)
+	}
+	return mergeNodes(merged, root, files), nil
+}
+
+func markFile(n *yaml.Node, filename string, files map[*yaml.Node]string) {
+	files[n] = filename
+	for _, c := range n.Content {
+		markFile(c, filename, files)
+	}
+}
+
+// mergeNodes merges over into base. Mappings are merged key by key, so headers and client settings
+// can be completed rather than replaced. Any other value in over, lists included, replaces the one in base.
+// Merged mappings are located where over is.
+func mergeNodes(base *yaml.Node, over *yaml.Node, files map[*yaml.Node]string) *yaml.Node {
+	if base == nil || base.Kind != yaml.MappingNode || over.Kind != yaml.MappingNode {
+		return over
+	}
+	merged := *over
+	merged.Content = append([]*yaml.Node(nil), base.Content...)
+	files[&merged] = files[over]
+	for i := 0; i+1 < len(over.Content); i += 2 {
+		key, value := over.Content[i], over.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(merged.Content); j += 2 {
+			if merged.Content[j].Value == key.Value {
+				merged.Content[j], merged.Content[j+1] = key, mergeNodes(merged.Content[j+1], value, files)
+				found = true
+			}
+		}
+		if !found {
+			merged.Content = append(merged.Content, key, value)
+		}
+	}
+	return &merged
+}
+
+// mappingValue returns the value of a key in a mapping node, or nil
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// resolveTemplates merges the template each run extends under the run. Templates can extend other templates.
+func resolveTemplates(root *yaml.Node, files map[*yaml.Node]string) error {
+	templates := mappingValue(root, "templates")
+	runs := mappingValue(root, "runs")
+	where := func(n *yaml.Node) string {
+		return fmt.Sprintf("%s:%d", files[n], n.Line)
+	}
+	if templates != nil {
+		if templates.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s: templates must map names to run settings", where(templates))
+		}
+		for i := 0; i+1 < len(templates.Content); i += 2 {
+			name, t := templates.Content[i], templates.Content[i+1]
+			if err := decodeStrict(t, &runConf{}); err != nil {
+				return fmt.Errorf("%s: invalid template %q: %s", where(t), name.Value, yamlErrorText(err))
+			}
+		}
+	}
+
+	var resolve func(ref *yaml.Node, seen []string) (*yaml.Node, error)
+	resolve = func(ref *yaml.Node, seen []string) (*yaml.Node, error) {
+		for _, name := range seen {
+			if name == ref.Value {
+				return nil, fmt.Errorf("%s: template cycle: %s", where(ref), strings.Join(append(seen, ref.Value), " -> "))
+			}
+		}
+		t := mappingValue(templates, ref.Value)
+		if t == nil {
+			return nil, fmt.Errorf("%s: unknown template %q", where(ref), ref.Value)
+		}
+		if parent := mappingValue(t, "extends"); parent != nil {
+			base, err := resolve(parent, append(seen, ref.Value))
+			if err != nil {
+				return nil, err
+			}
+			return mergeNodes(base, t, files), nil
+		}
+		return t, nil
+	}
+
+	if runs == nil || runs.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for i, run := range runs.Content {
+		ref := mappingValue(run, "extends")
+		if ref == nil {
+			continue
+		}
+		t, err := resolve(ref, nil)
+		if err != nil {
+			return err
+		}
+		runs.Content[i] = mergeNodes(t, run, files)
+	}
+	return nil
+}
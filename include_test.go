@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// writeSpecFiles writes batch files to a temporary directory, returning the directory
+func writeSpecFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestMergeNodes(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		over string
+		want string
+	}{
+		{
+			name: "mappings merged key by key",
+			base: "headers: {A: base, B: base}\nclient: {max_conns: 10}\n",
+			over: "headers: {B: over, C: over}\nname: over\n",
+			want: "headers: {A: base, B: over, C: over}\nclient: {max_conns: 10}\nname: over\n",
+		},
+		{
+			name: "lists replaced",
+			base: "include: [a.yml, b.yml]\nruns: [{requests: 1}, {requests: 2}]\n",
+			over: "runs: [{requests: 3}]\n",
+			want: "include: [a.yml, b.yml]\nruns: [{requests: 3}]\n",
+		},
+		{
+			name: "scalars replace mappings",
+			base: "client: {max_conns: 10}\n",
+			over: "client: null\n",
+			want: "client: null\n",
+		},
+	}
+	for _, tt := range tests {
+		var base, over, want yaml.Node
+		for _, n := range []struct {
+			text string
+			node *yaml.Node
+		}{{tt.base, &base}, {tt.over, &over}, {tt.want, &want}} {
+			if err := yaml.Unmarshal([]byte(n.text), n.node); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		merged := mergeNodes(base.Content[0], over.Content[0], make(map[*yaml.Node]string))
+		var got, expected interface{}
+		if err := merged.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if err := want.Decode(&expected); err != nil {
+			t.Fatal(err)
+		}
+		gotText, _ := yaml.Marshal(got)
+		wantText, _ := yaml.Marshal(expected)
+		if string(gotText) != string(wantText) {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, gotText, wantText)
+		}
+	}
+}
+
+func TestGetConfIncludes(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"common/base.yml": "url: http://base/\nheaders: {A: base, B: base}\nclient: {max_conns: 5, read_timeout: 2s}\n",
+		"common/auth.yml": "include: [base.yml]\nheaders: {B: auth, C: auth}\n",
+		"test.yml":        "include: [common/auth.yml]\nname: test\nheaders: {C: test}\nruns:\n  - {requests: 1, concurrency: 1}\n",
+	})
+	var conf batchSpec
+	if _, err := conf.getConf(filepath.Join(dir, "test.yml"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Name != "test" || conf.Url != "http://base/" {
+		t.Errorf("got name %q and url %q", conf.Name, conf.Url)
+	}
+	for k, v := range map[string]string{"A": "base", "B": "auth", "C": "test"} {
+		if conf.Headers[k] != v {
+			t.Errorf("header %s = %q, want %q", k, conf.Headers[k], v)
+		}
+	}
+	if conf.Client.MaxConns != 5 || conf.Client.ReadTimeout.String() != "2s" {
+		t.Errorf("client settings not merged: %+v", conf.Client)
+	}
+}
+
+func TestGetConfTemplates(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"test.yml": `
+url: http://target/
+templates:
+  smoke:
+    requests: 10
+    concurrency: 1
+    headers: {A: smoke, B: smoke}
+  load:
+    extends: smoke
+    requests: 1000
+    headers: {B: load}
+runs:
+  - extends: smoke
+  - extends: load
+    concurrency: 50
+    headers: {C: run}
+`,
+	})
+	var conf batchSpec
+	if _, err := conf.getConf(filepath.Join(dir, "test.yml"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Runs) != 2 {
+		t.Fatalf("got %d runs, want 2", len(conf.Runs))
+	}
+	smoke, load := conf.Runs[0], conf.Runs[1]
+	if smoke.Requests != 10 || smoke.Concurrency != 1 || smoke.Headers["B"] != "smoke" {
+		t.Errorf("smoke run: %+v", smoke)
+	}
+	if load.Requests != 1000 || load.Concurrency != 50 {
+		t.Errorf("load run: requests %d, concurrency %d", load.Requests, load.Concurrency)
+	}
+	for k, v := range map[string]string{"A": "smoke", "B": "load", "C": "run"} {
+		if load.Headers[k] != v {
+			t.Errorf("load run header %s = %q, want %q", k, load.Headers[k], v)
+		}
+	}
+}
+
+func TestGetConfErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "include cycle",
+			files: map[string]string{
+				"test.yml": "include: [a.yml]\n",
+				"a.yml":    "include: [b.yml]\n",
+				"b.yml":    "include: [a.yml]\n",
+			},
+			wantErr: "include cycle",
+		},
+		{
+			name:    "unknown key in an included file",
+			files:   map[string]string{"test.yml": "include: [a.yml]\n", "a.yml": "url: http://x/\nnope: 1\n"},
+			wantErr: "a.yml: yaml: unmarshal errors:\n  line 2: field nope not found",
+		},
+		{
+			name:    "template cycle",
+			files:   map[string]string{"test.yml": "templates:\n  a: {extends: b}\n  b: {extends: a}\nruns:\n  - extends: a\n"},
+			wantErr: "template cycle: a -> b -> a",
+		},
+		{
+			name:    "unknown template",
+			files:   map[string]string{"test.yml": "runs:\n  - extends: nope\n"},
+			wantErr: `test.yml:2: unknown template "nope"`,
+		},
+		{
+			name:    "invalid template",
+			files:   map[string]string{"test.yml": "templates:\n  a: {requests: many}\n"},
+			wantErr: `invalid template "a"`,
+		},
+	}
+	for _, tt := range tests {
+		dir := writeSpecFiles(t, tt.files)
+		var conf batchSpec
+		_, err := conf.getConf(filepath.Join(dir, "test.yml"), nil)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -13,19 +13,67 @@ import (
 )
 
 type respStatus struct {
-	code int
-	err  string
+	code     int
+	err      string
+	id       string
+	traceID  string
+	endpoint string
+	start    time.Time
+	latency  time.Duration
+	bytesIn  int
+	bytesOut int
+	// gRPC status code name, only set for gRPC runs
+	grpcStatus string
+	// name used to group stats, such as a GraphQL operation
+	operation string
+	// set for warm-up requests, which are kept out of the run stats
+	warmup bool
+	// position of a scenario step, used to order operations
+	step int
+}
+
+type reqInfo struct {
+	id     string
+	userID int
+	count  int
+	// values drawn from feeders for this request
+	vars map[string]string
 }
 
 type testParams struct {
 	name            string
 	runID           string
-	client          fasthttp.Client
+	label           string
+	group           string
+	params          []matrixParam
+	vars            map[string]string
+	headers         []headerTemplate
+	urlTemplate     *requestTemplate
+	body            *requestTemplate
+	feeders         []*feeder
+	scenario        *scenario
+	runType         string
+	client          targetClient
+	grpc            *grpcTarget
+	grpcCodes       map[string]int
+	ws              *wsTarget
+	sse             *sseTarget
+	graphql         *graphqlTarget
+	conns           *connStats
 	url             string
 	rateLimit       float64
 	concurrentUsers int
 	responseCodes   [6]int
 	errorCount      map[string]int
+	idName          string
+	idFormat        *idFormat
+	idLocation      string
+	workerID        int
+	trace           traceConf
+	rawLog          *rawLogger
+	stats           *runStats
+	warmup          *warmupPhase
+	metrics         *metricsRegistry
 	totalRequests   int
 	statusChan      chan respStatus
 	userCount       int
@@ -41,8 +89,32 @@ const separator string = "======================================================
 
 var initMessage string = "\nTest: %21s\nRun ID: %18s\nRequests target: %7d\nConcurrency level: %2d"
 var resultMessage string = "\nRequests sent: %d\nAverage RPS: %.0f\nResponse codes received: \n  1xx: %d | 2xx: %d | 3xx: %d | 4xx: %d | 5xx: %d | Unknown: %d"
+var grpcResultMessage string = "\nRequests sent: %d\nAverage RPS: %.0f\nFailed: %d\ngRPC status codes received: \n  %s"
 
 func main() {
+	validateOnly := false
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			validateOnly = true
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case "report":
+			if err := reportCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Error writing HTML report: %v\n", err)
+			}
+			return
+		case "compare":
+			regressions, err := compareCommand(os.Args[2:], os.Stdout)
+			if err != nil {
+				log.Fatalf("Error comparing results: %v\n", err)
+			}
+			if regressions > 0 {
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	runc := flag.Int("run", 1, "int. Run counter to use as RID in id header")
 	c := flag.Int("c", 1, "int. Number of concurrent connections")
 	n := flag.Int("n", 1, "int. Number of requests to perform")
@@ -50,15 +122,69 @@ func main() {
 	readTimeout := flag.Int("rtimeout", 500, "int. Maximum duration for full response reading (including body) in milliseconds")
 	writeTimeout := flag.Int("wtimeout", 500, "int. Maximum duration for full request writing (including body) in milliseconds")
 	maxConnections := flag.Int("maxconn", 1000, "int. Maximum number of connections per each host which may be established.")
+	caCert := flag.String("cacert", "", "string. Path of a PEM file with CA certificates used to verify target servers")
+	clientCert := flag.String("cert", "", "string. Path of a PEM client certificate for mutual TLS")
+	clientKey := flag.String("key", "", "string. Path of the PEM private key for the client certificate")
+	insecure := flag.Bool("insecure", false, "bool. Target server certificates are not verified if set")
+	sni := flag.String("sni", "", "string. Server name sent in TLS handshakes and used to verify certificates. Defaults to the target host")
+	tlsMin := flag.String("tls-min", "", "string. Minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	protocol := flag.String("protocol", protocolHTTP1, "string. Protocol used for target requests: http1, h2 (HTTP/2 over TLS) or h2c (HTTP/2 over cleartext)")
 	isDistributed := flag.Bool("distributed", false, "bool. Blowhole will perform requests using distributed clients if set.")
 	isWorker := flag.Bool("worker", false, "bool. Blowhole instance will act as distributed worker if set. It has no effect unless \"distributed\" is also set.")
 	output := flag.String("o", "", "string. Output destination for results. If not set, defaults to stdout.")
 	batchFile := flag.String("file", "", "string. Path of YAML file describing a batch of runs")
+	idHeader := flag.String("id-header", "id", "string. Name of the header, query parameter or body field carrying the unique id")
+	idFormatString := flag.String("id-format", defaultIDFormat, "string. Template for the unique id. Supports {RID}, {UID}, {CID}, {WID} and {TS} placeholders, with optional zero-padding width as in {UID:5}")
+	idLocation := flag.String("id-location", idInHeader, "string. Where to send the unique id: header, query or body")
+	trace := flag.String("trace", "", "string. Comma-separated list of trace propagation headers to send with each request: w3c, b3 or b3single")
+	traceState := flag.String("tracestate", "", "string. Value of the tracestate header sent along with W3C traceparent headers")
+	rawLogPath := flag.String("raw-log", "", "string. Path of a file where one line per request is written")
+	rawLogFormat := flag.String("raw-format", "", "string. Format of the raw log: jsonl or csv. If not set, it is inferred from the raw log file extension")
+	interval := flag.Duration("interval", 0, "duration. Length of each time-series bucket, e.g. 1s. Time series are not recorded if not set")
+	jsonReport := flag.String("json", "", "string. Path of a file where results for all runs are written as JSON")
+	seriesFile := flag.String("series", "", "string. Path of a CSV file where time-series buckets for all runs are written")
+	htmlReport := flag.String("html", "", "string. Path of a file where an HTML report for all runs is written")
+	runType := flag.String("type", runHTTP, "string. Type of requests to perform: http, graphql, grpc, websocket or sse")
+	grpcMethod := flag.String("method", "", "string. Full name of the gRPC method to call, e.g. package.Service/Method")
+	protoSet := flag.String("proto-set", "", "string. Path of a protobuf descriptor set describing the gRPC method. Server reflection is used if not set")
+	body := flag.String("body", "", "string. Request body template. Sent with a POST for HTTP runs, used as the JSON request message for gRPC runs and as the message for WebSocket runs")
+	graphqlQuery := flag.String("query", "", "string. Path of a GraphQL document with the query or mutation to send in GraphQL runs")
+	graphqlVariables := flag.String("variables", "", "string. JSON template for the variables sent in GraphQL runs")
+	graphqlOperation := flag.String("operation", "", "string. Operation name sent in GraphQL runs")
+	wsRate := flag.Float64("ws-rate", 0, "float. Messages per second sent by each WebSocket user. Messages are sent as fast as possible if not set")
+	wsReply := flag.Bool("ws-reply", false, "bool. Each WebSocket message waits for a reply containing its id if set")
+	unixSocket := flag.String("unix-socket", "", "string. Path of a Unix domain socket to connect through. Requests keep the host and URL of the target")
+	dialAddr := flag.String("dial", "", "string. Fixed ip:port to connect to in place of the target host. Requests keep the host and URL of the target")
+	proxyURL := flag.String("proxy", "", "string. Forward proxy all target connections go through: http://[user:pass@]host:port or socks5://[user:pass@]host:port")
+	sseDuration := flag.Duration("sse-duration", 10*time.Second, "duration. How long each SSE stream is held open, reconnecting if the server ends it earlier")
+	warmup := flag.Duration("warmup", 0, "duration. Send traffic for this long before each run is measured, excluding it from results")
+	warmupRequests := flag.Int("warmup-requests", 0, "int. Send this many requests before each run is measured, excluding them from results")
+	metricsAddr := flag.String("metrics-addr", "", "string. Address to serve a Prometheus /metrics endpoint from while runs are in progress, e.g. :9464")
+	dryRun := flag.Bool("dry-run", false, "bool. Validate the batch spec and print the plan for each run, without sending any request")
+	vars := setFlags{}
+	flag.Var(vars, "set", "key=value. Value for ${key} references in the batch file, taking precedence over environment variables. Can be repeated")
 	flag.Parse()
+	if validateOnly {
+		// "blowhole validate [options] file.yml" is a dry run of the given batch file
+		if flag.NArg() > 0 {
+			*batchFile = flag.Arg(0)
+			_ = flag.CommandLine.Parse(flag.Args()[1:])
+		}
+		if *batchFile == "" {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage: blowhole validate [options] batch.yml\n")
+			os.Exit(2)
+		}
+		*dryRun = true
+	}
 
 	var batch batchSpec
+	var lines specLines
 	if *batchFile != "" {
-		batch.getConf(*batchFile)
+		var err error
+		lines, err = batch.getConf(*batchFile, vars)
+		if err != nil {
+			log.Fatalf("Error loading batch file: %v\n", err)
+		}
 	} else {
 		batch = batchSpec{
 			Name: "unnamed",
@@ -73,86 +199,91 @@ func main() {
 		}
 
 	}
+	batch.IDHeader = override(batch.IDHeader, *idHeader)
+	batch.IDFormat = override(batch.IDFormat, *idFormatString)
+	batch.IDLocation = override(batch.IDLocation, *idLocation)
+	batch.Trace = override(batch.Trace, *trace)
+	batch.TraceState = override(batch.TraceState, *traceState)
+	batch.RawLog = override(batch.RawLog, *rawLogPath)
+	batch.RawFormat = override(batch.RawFormat, *rawLogFormat)
+	batch.JSONReport = override(batch.JSONReport, *jsonReport)
+	batch.SeriesFile = override(batch.SeriesFile, *seriesFile)
+	batch.MetricsAddr = override(batch.MetricsAddr, *metricsAddr)
+	batch.HTMLReport = override(batch.HTMLReport, *htmlReport)
+	batch.Protocol = override(batch.Protocol, *protocol)
+	batch.UnixSocket = override(batch.UnixSocket, *unixSocket)
+	batch.Dial = override(batch.Dial, *dialAddr)
+	batch.Proxy = override(batch.Proxy, *proxyURL)
+	batch.Type = override(batch.Type, *runType)
+	batch.Method = override(batch.Method, *grpcMethod)
+	batch.ProtoSet = override(batch.ProtoSet, *protoSet)
+	batch.Body = override(batch.Body, *body)
+	batch.WSReply = batch.WSReply || *wsReply
+	batch.Query = override(batch.Query, *graphqlQuery)
+	batch.Variables = override(batch.Variables, *graphqlVariables)
+	batch.Operation = override(batch.Operation, *graphqlOperation)
+	if batch.WSRate == 0 {
+		batch.WSRate = *wsRate
+	}
+	if batch.SSEDuration == 0 {
+		batch.SSEDuration = *sseDuration
+	}
+	if batch.Warmup == 0 && batch.WarmupRequests == 0 {
+		batch.Warmup, batch.WarmupRequests = *warmup, *warmupRequests
+	}
+	batch.Client = batch.Client.over(clientOptions{
+		ReadTimeout:  time.Duration(*readTimeout) * time.Millisecond,
+		WriteTimeout: time.Duration(*writeTimeout) * time.Millisecond,
+		MaxConns:     *maxConnections,
+	})
+	batch.TLS.CACert = override(batch.TLS.CACert, *caCert)
+	batch.TLS.Cert = override(batch.TLS.Cert, *clientCert)
+	batch.TLS.Key = override(batch.TLS.Key, *clientKey)
+	batch.TLS.Insecure = batch.TLS.Insecure || *insecure
+	batch.TLS.SNI = override(batch.TLS.SNI, *sni)
+	batch.TLS.MinVersion = override(batch.TLS.MinVersion, *tlsMin)
+	tlsConfig, err := buildTLSConfig(batch.TLS)
+	if err != nil {
+		log.Fatalf("Error loading TLS options: %v\n", err)
+	}
+	if batch.Interval == 0 {
+		batch.Interval = *interval
+	}
 
-	if batch.Output != "" {
-		file, err := os.OpenFile(batch.Output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer file.Close()
-		log.SetOutput(file)
-
-		initMessage = "test %s,%s,%d,%d"
-		resultMessage = "%d,%.0f,%[8]d"
-	}
-
-	for i, run := range batch.Runs {
-		params := &testParams{
-			name: batch.Name,
-			client: fasthttp.Client{
-				MaxConnsPerHost:               *maxConnections,
-				ReadTimeout:                   time.Duration(*readTimeout) * time.Millisecond,
-				WriteTimeout:                  time.Duration(*writeTimeout) * time.Millisecond,
-				DisableHeaderNamesNormalizing: true,
-			},
-			url:             batch.Url,
-			rateLimit:       0,
-			concurrentUsers: run.Concurrency,
-			responseCodes:   [6]int{},
-			totalRequests:   run.Requests,
-			statusChan:      make(chan respStatus, 1000),
-			errorCount:      make(map[string]int),
-			userCount:       0,
-			master:          batch.IsDistributed && !batch.IsWorker,
-			worker:          batch.IsDistributed && batch.IsWorker,
-			expectedWorkers: 2,
-			pbar: progressbar.NewOptions(run.Requests,
-				progressbar.OptionEnableColorCodes(true),
-				progressbar.OptionShowIts(),
-				progressbar.OptionSetWidth(len(separator)),
-				progressbar.OptionShowCount(),
-				progressbar.OptionSetItsString("requests"),
-				progressbar.OptionShowElapsedTimeOnFinish(),
-			),
-			rps: 0,
-		}
-
-		rid := *runc
-		if rid == 1 {
-			rid = i + 1
-		}
-		params.runID = fmt.Sprintf("RID%03d", rid)
-
-		if run.CustomID != "" {
-			params.runID = run.CustomID
-		}
-
-		if run.CustomURL != "" {
-			params.url = run.CustomURL
-		}
-
-		if params.master {
-			startDistributedTest(params)
-		} else if params.worker {
-			startDistributedWorker(params)
-		} else {
-			startLumpedTest(params)
+	if errs := batch.validate(lines); len(errs) > 0 {
+		for _, err := range errs {
+			log.Println(err)
 		}
-
+		log.Fatalf("Invalid batch spec: %d errors found\n", len(errs))
+	}
+	if *dryRun {
+		batch.printPlan(os.Stdout, *runc)
+		return
 	}
 
+	runBatch(&batch, *runc, tlsConfig)
 }
 
-func startLumpedTest(params *testParams) {
+func startLumpedTest(params *testParams) runResult {
 	go statusWorker(params)
 
 	remainder := params.totalRequests % params.concurrentUsers
 	requestsPerUser := (params.totalRequests - remainder) / params.concurrentUsers
 
-	fmt.Printf("%s\nTest \"%s\" running - Run: %s\n\n", separator, params.name, params.runID)
+	outputMu.Lock()
+	fmt.Printf("%s\nTest \"%s\" running - Run: %s\n", separator, params.name, params.runID)
+	if params.label != "" {
+		fmt.Printf("Label: %s\n", params.label)
+	}
+	fmt.Println()
 	log.Printf(initMessage, params.name, params.runID, params.totalRequests, params.concurrentUsers)
 	fmt.Println()
+	outputMu.Unlock()
 
+	params.stats.start = time.Now()
+	if params.warmup != nil {
+		params.warmup.begin(params, params.concurrentUsers+1)
+	}
 	var i int
 	params.wg.Add(params.concurrentUsers)
 	for i = 0; i < params.concurrentUsers; i++ {
@@ -167,10 +298,19 @@ func startLumpedTest(params *testParams) {
 	close(params.statusChan)
 
 	params.wg.Wait()
-
-	fmt.Print("\n\n")
-	log.Printf(resultMessage, params.responseCodes[0]+params.responseCodes[1]+params.responseCodes[2]+params.responseCodes[3]+params.responseCodes[4]+params.responseCodes[5],
-		params.rps*1024/float64(params.totalRequests), params.responseCodes[0], params.responseCodes[1], params.responseCodes[2], params.responseCodes[3], params.responseCodes[4], params.responseCodes[5])
+	params.stats.end = time.Now()
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	// runs in a parallel group finish in any order, so each result block names its run
+	fmt.Printf("\n\nTest \"%s\" results - Run: %s\n", params.name, params.runID)
+	sent := params.responseCodes[0] + params.responseCodes[1] + params.responseCodes[2] + params.responseCodes[3] + params.responseCodes[4] + params.responseCodes[5]
+	if params.grpc != nil {
+		log.Printf(grpcResultMessage, sent, params.rps*1024/float64(params.totalRequests), params.stats.failed, formatGRPCCodes(params.grpcCodes))
+	} else {
+		log.Printf(resultMessage, sent,
+			params.rps*1024/float64(params.totalRequests), params.responseCodes[0], params.responseCodes[1], params.responseCodes[2], params.responseCodes[3], params.responseCodes[4], params.responseCodes[5])
+	}
 
 	if len(params.errorCount) != 0 {
 		fmt.Println("Error count:")
@@ -178,29 +318,102 @@ func startLumpedTest(params *testParams) {
 	for e, c := range params.errorCount {
 		fmt.Printf("  + %d: \"%s\"\n", c, e)
 	}
+	result := params.stats.result(params)
+	if params.grpc == nil && params.ws == nil && params.sse == nil {
+		fmt.Printf("Connections opened: %d", result.Connections.Connections)
+		if result.Connections.TLSHandshakes > 0 {
+			fmt.Printf(" | TLS handshakes: %d (%d failed, mean %.2f ms)", result.Connections.TLSHandshakes,
+				result.Connections.TLSFailures, result.Connections.TLSHandshakeMs)
+		}
+		if result.Connections.ProxyConnects > 0 {
+			fmt.Printf(" | Proxy connects: %d (%d failed, mean %.2f ms)", result.Connections.ProxyConnects,
+				result.Connections.ProxyFailures, result.Connections.ProxyConnectMs)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%s: min %.2f | mean %.2f | p50 %.2f | p90 %.2f | p99 %.2f | max %.2f\n", latencyLabel(result),
+		result.Latency.Min, result.Latency.Mean, result.Latency.P50, result.Latency.P90, result.Latency.P99, result.Latency.Max)
+	printOperations(result.Operations)
+	if result.WebSocket != nil {
+		printWSSummary(result.WebSocket)
+	}
+	if result.SSE != nil {
+		printSSESummary(result.SSE)
+	}
+	if result.Warmup != nil {
+		printWarmupSummary(result.Warmup)
+	}
+	printSeries(result)
 	fmt.Println(separator)
+
+	return result
 }
 
 func iterate(params *testParams, target int, userID int) {
 	defer params.wg.Done()
+	if params.metrics != nil {
+		params.metrics.userStarted(params.name, params.runID)
+		defer params.metrics.userDone(params.name, params.runID)
+	}
 
-	for i := 0; i < target; i++ {
-		reqID := fmt.Sprintf("%s.UID%05d.CID%06d", params.runID, userID, i)
-		params.statusChan <- sendRequest(params, reqID)
-		err := params.pbar.Add(1)
+	if params.ws != nil {
+		params.ws.iterate(params, target, userID)
+		return
+	}
+
+	first := 0
+	if params.warmup != nil {
+		first = params.warmup.run(params, userID)
+	}
+	for i := first; i < first+target; i++ {
+		info, err := newReqInfo(params, userID, i)
 		if err != nil {
-			log.Println(err)
+			return
+		}
+		if params.sse != nil {
+			params.statusChan <- params.sse.session(params, info)
+			progress(params)
+			continue
+		}
+		if params.scenario != nil {
+			params.scenario.run(params, info, func(res respStatus) { params.statusChan <- res })
+			progress(params)
+			continue
 		}
-		params.rps += params.pbar.State().KBsPerSecond
+		params.statusChan <- sendRequest(params, info)
+		progress(params)
 	}
 }
 
+func progress(params *testParams) {
+	err := params.pbar.Add(1)
+	if err != nil {
+		log.Println(err)
+	}
+	params.rps += params.pbar.State().KBsPerSecond
+}
+
 func statusWorker(params *testParams) {
 	// responseCodes <[100s, 200s, 300s, 400s, 500s, unknowns]>
 	defer params.wg.Done()
 
 	for input := range params.statusChan {
-		switch code, e := input.code, input.err; code != 0 {
+		if params.rawLog != nil {
+			params.rawLog.log(params, input)
+		}
+		if input.warmup {
+			// warm-up traffic is kept out of live metrics as well as results
+			params.warmup.add(input)
+			continue
+		}
+		if input.grpcStatus != "" {
+			params.grpcCodes[input.grpcStatus]++
+		}
+		params.stats.add(input)
+		if params.metrics != nil {
+			params.metrics.observe(params.name, params.runID, input)
+		}
+		switch code := input.code; code != 0 {
 		case code >= 100 && code < 200:
 			params.responseCodes[0]++
 		case code >= 200 && code < 300:
@@ -213,23 +426,86 @@ func statusWorker(params *testParams) {
 			params.responseCodes[4]++
 		default:
 			params.responseCodes[5]++
-			if e != "" {
-				params.errorCount[e]++
-			}
+		}
+		if input.err != "" {
+			params.errorCount[input.err]++
 		}
 	}
 }
 
-func sendRequest(params *testParams, id string) (res respStatus) {
+func sendRequest(params *testParams, info reqInfo) (res respStatus) {
+	if params.grpc != nil {
+		return params.grpc.send(params, info)
+	}
+
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
-	req.Header.Set("id", id)
-	req.SetRequestURI(params.url)
+	uri, err := renderURL(params, info)
+	if err != nil {
+		res.code = -1
+		res.err = err.Error()
+		return
+	}
+	req.SetRequestURI(uri)
+	switch params.idLocation {
+	case idInQuery:
+		req.URI().QueryArgs().Set(params.idName, info.id)
+	case idInBody:
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.Header.SetContentType("application/json")
+		req.SetBody(idBody(params.idName, info.id))
+	default:
+		req.Header.Set(params.idName, info.id)
+	}
+	if err := renderHeaders(params, info, req.Header.Set); err != nil {
+		res.code = -1
+		res.err = err.Error()
+		return
+	}
+	if params.body != nil {
+		body, err := params.body.render(templateVars(params, info))
+		if err != nil {
+			res.code = -1
+			res.err = err.Error()
+			return
+		}
+		req.Header.SetMethod(fasthttp.MethodPost)
+		if len(req.Header.ContentType()) == 0 {
+			req.Header.SetContentType("application/json")
+		}
+		req.SetBody([]byte(body))
+	}
+	if params.graphql != nil {
+		body, operation, err := params.graphql.body(templateVars(params, info))
+		if err != nil {
+			res.code = -1
+			res.err = err.Error()
+			return
+		}
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.Header.SetContentType("application/json")
+		req.SetBody(body)
+		res.operation = operation
+	}
+	if params.trace.enabled() {
+		var spanID string
+		res.traceID, spanID = traceIDs(params.runID, params.workerID, info.userID, info.count)
+		params.trace.apply(&req.Header, res.traceID, spanID)
+	}
+	res.id = info.id
+	res.endpoint = uri
+	res.bytesOut = len(req.Header.Header()) + len(req.Body())
 
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	err := params.client.Do(req, resp)
+	if params.metrics != nil {
+		params.metrics.requestSent(params.name, params.runID)
+		defer params.metrics.requestFinished(params.name, params.runID)
+	}
+	res.start = time.Now()
+	err = params.client.Do(req, resp)
+	res.latency = time.Since(res.start)
 	if err != nil {
 		res.code = -1
 		res.err = err.Error()
@@ -238,6 +514,10 @@ func sendRequest(params *testParams, id string) (res respStatus) {
 		res.err = "Error: empty response"
 	} else {
 		res.code = resp.StatusCode()
+		res.bytesIn = len(resp.Header.Header()) + len(resp.Body())
+		if params.graphql != nil && res.code < 300 {
+			res.err = params.graphql.responseError(resp.Body())
+		}
 	}
 	return
 }
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// matrixParam is the value of a matrix key for an expanded run
+type matrixParam struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// expandMatrix replaces the runs of a batch spec with the cartesian product of each run and the matrix values.
+// The first matrix key varies fastest, so runs sweeping its values are contiguous. The index of the run each
+// expanded run comes from is returned, or -1 if the spec has a matrix but no runs. runNodes are the nodes
+// the runs were decoded from, which matrix values are merged over before decoding each expanded run.
+func (conf *batchSpec) expandMatrix(runNodes []*yaml.Node, files map[*yaml.Node]string) ([]int, error) {
+	origins := make([]int, len(conf.Runs))
+	for i := range origins {
+		origins[i] = i
+	}
+	m := &conf.Matrix
+	if m.Kind == 0 {
+		return origins, nil
+	}
+	if m.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: matrix must map run keys to lists of values", m.Line)
+	}
+
+	var keys []*yaml.Node
+	var values [][]*yaml.Node
+	total := 1
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		key, list := m.Content[i], m.Content[i+1]
+		if list.Kind != yaml.SequenceNode || len(list.Content) == 0 {
+			return nil, fmt.Errorf("line %d: matrix %s must be a non-empty list", list.Line, key.Value)
+		}
+		for _, v := range list.Content {
+			var probe runConf
+			if err := decodeStrict(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{key, v}}, &probe); err != nil {
+				return nil, fmt.Errorf("line %d: invalid matrix value for %s: %s", v.Line, key.Value, yamlErrorText(err))
+			}
+		}
+		keys = append(keys, key)
+		values = append(values, list.Content)
+		total *= len(list.Content)
+	}
+
+	bases := conf.Runs
+	baseOrigins := origins
+	if len(bases) == 0 {
+		bases = []runConf{{}}
+		baseOrigins = []int{-1}
+		runNodes = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+
+	var runs []runConf
+	origins = nil
+	for b, base := range bases {
+		for n := 0; n < total; n++ {
+			mapping := &yaml.Node{Kind: yaml.MappingNode}
+			var params []matrixParam
+			var label []string
+			for k, idx := 0, n; k < len(keys); k++ {
+				v := values[k][idx%len(values[k])]
+				idx /= len(values[k])
+				mapping.Content = append(mapping.Content, keys[k], v)
+				value := matrixValue(v)
+				params = append(params, matrixParam{Name: keys[k].Value, Value: value})
+				label = append(label, keys[k].Value+"="+value)
+			}
+			// each expanded run is decoded on its own, so runs don't share the maps and slices of their base
+			var run runConf
+			if err := decodeStrict(mergeNodes(runNodes[b], mapping, files), &run); err != nil {
+				return nil, fmt.Errorf("line %d: matrix: %v", m.Line, err)
+			}
+
+			run.Params = params
+			run.Label = strings.Join(label, " ")
+			if base.Label != "" {
+				run.Label = base.Label + " (" + run.Label + ")"
+			}
+			if base.CustomID != "" {
+				run.CustomID = base.CustomID + "-" + strconv.Itoa(n+1)
+			}
+			runs = append(runs, run)
+			origins = append(origins, baseOrigins[b])
+		}
+	}
+	conf.Runs = runs
+	return origins, nil
+}
+
+// decodeStrict decodes a node into v, rejecting keys v doesn't have. Errors point at the lines of the node.
+func decodeStrict(node *yaml.Node, v interface{}) error {
+	text, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(text))
+	dec.KnownFields(true)
+	err = dec.Decode(v)
+	var te *yaml.TypeError
+	if errors.As(err, &te) {
+		// decoding goes through a generated document, whose lines are mapped back to the node's
+		var gen yaml.Node
+		if yaml.Unmarshal(text, &gen) == nil && len(gen.Content) > 0 {
+			lines := make(map[int]int)
+			mapLines(gen.Content[0], node, lines)
+			for i, e := range te.Errors {
+				var line int
+				if _, scanErr := fmt.Sscanf(e, "line %d:", &line); scanErr == nil && lines[line] > 0 {
+					te.Errors[i] = fmt.Sprintf("line %d:%s", lines[line], strings.SplitN(e, ":", 2)[1])
+				}
+			}
+		}
+	}
+	return err
+}
+
+// mapLines maps the lines of a generated node to the lines of the node it was generated from
+func mapLines(gen *yaml.Node, orig *yaml.Node, lines map[int]int) {
+	if _, ok := lines[gen.Line]; !ok && orig.Line > 0 {
+		lines[gen.Line] = orig.Line
+	}
+	for i := 0; i < len(gen.Content) && i < len(orig.Content); i++ {
+		mapLines(gen.Content[i], orig.Content[i], lines)
+	}
+}
+
+// yamlErrorText strips the line numbers of errors from decoding generated documents
+func yamlErrorText(err error) string {
+	var te *yaml.TypeError
+	if errors.As(err, &te) {
+		msgs := make([]string, len(te.Errors))
+		for i, e := range te.Errors {
+			if _, msg, ok := strings.Cut(e, ": "); ok && strings.HasPrefix(e, "line ") {
+				e = msg
+			}
+			msgs[i] = e
+		}
+		return strings.Join(msgs, "; ")
+	}
+	return err.Error()
+}
+
+// matrixValue formats a matrix value for labels, with collections on a single line
+func matrixValue(v *yaml.Node) string {
+	if v.Kind == yaml.ScalarNode {
+		return v.Value
+	}
+	flow := *v
+	flow.Style = yaml.FlowStyle
+	text, err := yaml.Marshal(&flow)
+	if err != nil {
+		return v.Value
+	}
+	return strings.TrimSpace(string(text))
+}
+
+// matrixGroups splits runs by the values of every matrix parameter but the first, keeping run order,
+// so each group is a sweep over the first parameter
+func matrixGroups(runs []runResult) [][]runResult {
+	var groups [][]runResult
+	index := make(map[string]int)
+	for _, r := range runs {
+		var key []string
+		for i, p := range r.Params {
+			if i > 0 {
+				key = append(key, p.Name+"="+p.Value)
+			}
+		}
+		k := strings.Join(key, " ")
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], r)
+	}
+	return groups
+}
+
+// groupLabel describes the parameters shared by the runs of a group
+func groupLabel(group []runResult) string {
+	if len(group) == 0 || len(group[0].Params) < 2 {
+		return ""
+	}
+	var label []string
+	for _, p := range group[0].Params[1:] {
+		label = append(label, p.Name+"="+p.Value)
+	}
+	return strings.Join(label, " ")
+}
+
+// printMatrixSummary prints results side by side for tests with matrix parameters
+func printMatrixSummary(result testResult) {
+	if len(result.Runs) == 0 || len(result.Runs[0].Params) == 0 {
+		return
+	}
+	fmt.Printf("Matrix results for test %q\n", result.Name)
+	for _, group := range matrixGroups(result.Runs) {
+		if label := groupLabel(group); label != "" {
+			fmt.Printf("\n  %s\n", label)
+		}
+		fmt.Printf("  %-10s %-24s %10s %8s %10s %10s\n", "Run", group[0].Params[0].Name, "RPS", "Failed", "p50 ms", "p99 ms")
+		for _, r := range group {
+			if r.Skipped != "" {
+				fmt.Printf("  %-10s %-24s %10s\n", r.RunID, r.Params[0].Value, "skipped")
+				continue
+			}
+			fmt.Printf("  %-10s %-24s %10.1f %8d %10.2f %10.2f\n", r.RunID, r.Params[0].Value, r.RPS, r.Failed, r.Latency.P50, r.Latency.P99)
+		}
+	}
+	fmt.Println(separator)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandMatrix(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"test.yml": `
+url: http://target/
+matrix:
+  headers:
+    - {X-A: one}
+    - {X-A: two}
+  concurrency: [1, 10]
+runs:
+  - requests: 100
+    label: base
+    id: base
+    headers: {X-B: base}
+    stop_on_failure: true
+  - requests: 5
+`,
+	})
+	var conf batchSpec
+	lines, err := conf.getConf(filepath.Join(dir, "test.yml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Runs) != 8 {
+		t.Fatalf("got %d runs, want 8", len(conf.Runs))
+	}
+	if want := []int{0, 0, 0, 0, 1, 1, 1, 1}; !reflect.DeepEqual(lines.origins, want) {
+		t.Errorf("origins = %v, want %v", lines.origins, want)
+	}
+
+	tests := []struct {
+		run         int
+		label       string
+		id          string
+		concurrency int
+		headers     map[string]string
+	}{
+		{0, "base (headers={X-A: one} concurrency=1)", "base-1", 1, map[string]string{"X-A": "one", "X-B": "base"}},
+		{1, "base (headers={X-A: two} concurrency=1)", "base-2", 1, map[string]string{"X-A": "two", "X-B": "base"}},
+		{2, "base (headers={X-A: one} concurrency=10)", "base-3", 10, map[string]string{"X-A": "one", "X-B": "base"}},
+		{3, "base (headers={X-A: two} concurrency=10)", "base-4", 10, map[string]string{"X-A": "two", "X-B": "base"}},
+		{4, "headers={X-A: one} concurrency=1", "", 1, map[string]string{"X-A": "one"}},
+		{7, "headers={X-A: two} concurrency=10", "", 10, map[string]string{"X-A": "two"}},
+	}
+	for _, tt := range tests {
+		run := conf.Runs[tt.run]
+		if run.Label != tt.label || run.CustomID != tt.id || run.Concurrency != tt.concurrency {
+			t.Errorf("run %d: got label %q, id %q, concurrency %d", tt.run, run.Label, run.CustomID, run.Concurrency)
+		}
+		if !reflect.DeepEqual(run.Headers, tt.headers) {
+			t.Errorf("run %d: got headers %v, want %v", tt.run, run.Headers, tt.headers)
+		}
+		if len(run.Params) != 2 || run.Params[0].Name != "headers" || run.Params[1].Name != "concurrency" {
+			t.Errorf("run %d: got params %v", tt.run, run.Params)
+		}
+	}
+
+	// expanded runs must not share maps or pointers with each other
+	conf.Runs[0].Headers["X-A"] = "changed"
+	*conf.Runs[0].StopOnFailure = false
+	if conf.Runs[1].Headers["X-A"] != "two" || conf.Runs[2].Headers["X-A"] != "one" || !*conf.Runs[1].StopOnFailure {
+		t.Error("expanded runs share state")
+	}
+}
+
+func TestExpandMatrixWithoutRuns(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"test.yml": "url: http://target/\nmatrix:\n  concurrency: [1, 2, 4]\n",
+	})
+	var conf batchSpec
+	lines, err := conf.getConf(filepath.Join(dir, "test.yml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{-1, -1, -1}; !reflect.DeepEqual(lines.origins, want) {
+		t.Errorf("origins = %v, want %v", lines.origins, want)
+	}
+	for i, c := range []int{1, 2, 4} {
+		if conf.Runs[i].Concurrency != c {
+			t.Errorf("run %d: concurrency %d, want %d", i, conf.Runs[i].Concurrency, c)
+		}
+	}
+}
+
+func TestExpandMatrixErrors(t *testing.T) {
+	tests := []struct {
+		matrix  string
+		wantErr string
+	}{
+		{matrix: "matrix: [1, 2]\n", wantErr: "matrix must map run keys to lists of values"},
+		{matrix: "matrix:\n  concurrency: 4\n", wantErr: "matrix concurrency must be a non-empty list"},
+		{matrix: "matrix:\n  concurrency: []\n", wantErr: "matrix concurrency must be a non-empty list"},
+		{matrix: "matrix:\n  concurrency: [1, many]\n", wantErr: "line 2: invalid matrix value for concurrency"},
+		{matrix: "matrix:\n  nope: [1]\n", wantErr: "invalid matrix value for nope"},
+	}
+	for _, tt := range tests {
+		dir := writeSpecFiles(t, map[string]string{"test.yml": tt.matrix + "runs:\n  - {requests: 1}\n"})
+		var conf batchSpec
+		_, err := conf.getConf(filepath.Join(dir, "test.yml"), nil)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q: got error %v, want %q", tt.matrix, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var classLabels = [6]string{"1xx", "2xx", "3xx", "4xx", "5xx", "unknown"}
+
+type runLabels struct {
+	test string
+	run  string
+}
+
+type errorKey struct {
+	runLabels
+	errorType string
+}
+
+// runGauges hold the live state of a run
+type runGauges struct {
+	active   bool
+	inFlight int64
+	users    int64
+}
+
+type latencyHistogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// metricsRegistry keeps live load generator stats and renders them
+// in the Prometheus text exposition format. Stats are kept by run, as runs
+// in a parallel group are in progress at the same time.
+type metricsRegistry struct {
+	mu        sync.Mutex
+	responses map[runLabels]*[6]uint64
+	errors    map[errorKey]uint64
+	latencies map[runLabels]*latencyHistogram
+	gauges    map[runLabels]*runGauges
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{
+		responses: make(map[runLabels]*[6]uint64),
+		errors:    make(map[errorKey]uint64),
+		latencies: make(map[runLabels]*latencyHistogram),
+		gauges:    make(map[runLabels]*runGauges),
+	}
+}
+
+func (m *metricsRegistry) startRun(test string, run string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	labels := runLabels{test: test, run: run}
+	if _, ok := m.responses[labels]; !ok {
+		m.responses[labels] = &[6]uint64{}
+		m.latencies[labels] = &latencyHistogram{counts: make([]uint64, len(latencyBuckets))}
+		m.gauges[labels] = &runGauges{}
+	}
+	m.gauges[labels].active = true
+}
+
+// endRun marks a run as no longer in progress
+func (m *metricsRegistry) endRun(test string, run string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if g, ok := m.gauges[runLabels{test: test, run: run}]; ok {
+		g.active = false
+	}
+}
+
+// observe records a response for a run, which startRun must have been called for
+func (m *metricsRegistry) observe(test string, run string, res respStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	labels := runLabels{test: test, run: run}
+	m.responses[labels][statusClass(res.code)]++
+	if res.err != "" {
+		m.errors[errorKey{runLabels: labels, errorType: errorType(res.err)}]++
+	}
+	if res.code > 0 {
+		h := m.latencies[labels]
+		seconds := res.latency.Seconds()
+		for i, le := range latencyBuckets {
+			if seconds <= le {
+				h.counts[i]++
+			}
+		}
+		h.count++
+		h.sum += seconds
+	}
+}
+
+// gauge changes a live gauge of a run, which startRun must have been called for
+func (m *metricsRegistry) gauge(test string, run string, change func(g *runGauges)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	change(m.gauges[runLabels{test: test, run: run}])
+}
+
+func (m *metricsRegistry) userStarted(test string, run string) {
+	m.gauge(test, run, func(g *runGauges) { g.users++ })
+}
+
+func (m *metricsRegistry) userDone(test string, run string) {
+	m.gauge(test, run, func(g *runGauges) { g.users-- })
+}
+
+func (m *metricsRegistry) requestSent(test string, run string) {
+	m.gauge(test, run, func(g *runGauges) { g.inFlight++ })
+}
+
+func (m *metricsRegistry) requestFinished(test string, run string) {
+	m.gauge(test, run, func(g *runGauges) { g.inFlight-- })
+}
+
+// errorType buckets error messages into a small set of label values
+func errorType(err string) string {
+	e := strings.ToLower(err)
+	switch {
+	case strings.Contains(e, "timeout"):
+		return "timeout"
+	case strings.Contains(e, "connection refused"):
+		return "connection_refused"
+	case strings.Contains(e, "closed connection") || strings.Contains(e, "connection reset") || strings.Contains(e, "broken pipe"):
+		return "connection_closed"
+	case strings.Contains(e, "no such host") || strings.Contains(e, "lookup"):
+		return "dns"
+	case strings.Contains(e, "tls") || strings.Contains(e, "certificate") || strings.Contains(e, "x509"):
+		return "tls"
+	case strings.Contains(e, "empty response"):
+		return "empty_response"
+	default:
+		return "other"
+	}
+}
+
+func (l runLabels) String() string {
+	return fmt.Sprintf("test=%q,run=%q", l.test, l.run)
+}
+
+func (m *metricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sb strings.Builder
+	runs := make([]runLabels, 0, len(m.responses))
+	for l := range m.responses {
+		runs = append(runs, l)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].String() < runs[j].String() })
+
+	sb.WriteString("# HELP blowhole_run_info Test name and run ID of the runs in progress.\n# TYPE blowhole_run_info gauge\n")
+	for _, l := range runs {
+		if m.gauges[l].active {
+			fmt.Fprintf(&sb, "blowhole_run_info{%s} 1\n", l)
+		}
+	}
+
+	sb.WriteString("# HELP blowhole_responses_total Responses received, by status class.\n# TYPE blowhole_responses_total counter\n")
+	for _, l := range runs {
+		for i, c := range m.responses[l] {
+			fmt.Fprintf(&sb, "blowhole_responses_total{%s,class=%q} %d\n", l, classLabels[i], c)
+		}
+	}
+
+	sb.WriteString("# HELP blowhole_errors_total Failed requests, by error type.\n# TYPE blowhole_errors_total counter\n")
+	errs := make([]errorKey, 0, len(m.errors))
+	for k := range m.errors {
+		errs = append(errs, k)
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].String()+errs[i].errorType < errs[j].String()+errs[j].errorType
+	})
+	for _, k := range errs {
+		fmt.Fprintf(&sb, "blowhole_errors_total{%s,type=%q} %d\n", k.runLabels, k.errorType, m.errors[k])
+	}
+
+	sb.WriteString("# HELP blowhole_request_duration_seconds Latency of requests that received a response.\n# TYPE blowhole_request_duration_seconds histogram\n")
+	for _, l := range runs {
+		h := m.latencies[l]
+		for i, le := range latencyBuckets {
+			fmt.Fprintf(&sb, "blowhole_request_duration_seconds_bucket{%s,le=\"%g\"} %d\n", l, le, h.counts[i])
+		}
+		fmt.Fprintf(&sb, "blowhole_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", l, h.count)
+		fmt.Fprintf(&sb, "blowhole_request_duration_seconds_sum{%s} %g\n", l, h.sum)
+		fmt.Fprintf(&sb, "blowhole_request_duration_seconds_count{%s} %d\n", l, h.count)
+	}
+
+	sb.WriteString("# HELP blowhole_requests_in_flight Requests sent and waiting for a response.\n# TYPE blowhole_requests_in_flight gauge\n")
+	for _, l := range runs {
+		fmt.Fprintf(&sb, "blowhole_requests_in_flight{%s} %d\n", l, m.gauges[l].inFlight)
+	}
+	sb.WriteString("# HELP blowhole_active_users Concurrent users currently sending requests.\n# TYPE blowhole_active_users gauge\n")
+	for _, l := range runs {
+		fmt.Fprintf(&sb, "blowhole_active_users{%s} %d\n", l, m.gauges[l].users)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(sb.String()))
+}
+
+// serveMetrics starts a /metrics endpoint and returns a function that shuts it down
+func serveMetrics(addr string, m *metricsRegistry) func() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Could not serve metrics: %s", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// parseProxyURL validates a forward proxy URL: http://[user:pass@]host:port or socks5://[user:pass@]host:port
+func parseProxyURL(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %q", u.Scheme)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("proxy address must include a port: %q", u.Host)
+	}
+	return u, nil
+}
+
+// forwardsRequests tells whether requests to target go to the proxy in absolute form, as HTTP proxies expect for
+// plain http targets. Other targets, and every target of a SOCKS5 proxy, are reached through a tunnel.
+func forwardsRequests(proxyURL *url.URL, target string) bool {
+	return proxyURL != nil && proxyURL.Scheme == "http" && strings.HasPrefix(strings.ToLower(target), "http://")
+}
+
+// forwardingClient sends requests to an HTTP proxy in absolute form, for plain http targets
+func (conf clientConf) forwardingClient() targetClient {
+	opts := conf.options
+	return &netHTTPClient{
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyURL(conf.proxy),
+				DialContext:           conf.dialForwardProxy,
+				MaxConnsPerHost:       opts.MaxConns,
+				MaxIdleConnsPerHost:   opts.MaxConns,
+				IdleConnTimeout:       opts.MaxIdleConnDuration,
+				DisableKeepAlives:     opts.KeepAlive != nil && !*opts.KeepAlive,
+				ReadBufferSize:        opts.ReadBufferSize,
+				WriteBufferSize:       opts.WriteBufferSize,
+				ResponseHeaderTimeout: opts.ReadTimeout,
+			},
+			Timeout: opts.ReadTimeout + opts.WriteTimeout,
+		},
+	}
+}
+
+// dialForwardProxy opens a connection to the proxy itself, timed as a proxy connect
+func (conf clientConf) dialForwardProxy(ctx context.Context, network string, addr string) (net.Conn, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	start := time.Now()
+	conn, err := d.DialContext(ctx, network, addr)
+	atomic.AddInt64(&conf.stats.proxyNanos, int64(time.Since(start)))
+	atomic.AddInt64(&conf.stats.proxyConnects, 1)
+	if err != nil {
+		atomic.AddInt64(&conf.stats.proxyFails, 1)
+		return nil, err
+	}
+	atomic.AddInt64(&conf.stats.dials, 1)
+	return conn, nil
+}
+
+// dialProxy opens a tunnel to addr through the forward proxy, timing the proxy connection separately
+func (conf clientConf) dialProxy(ctx context.Context, addr string) (net.Conn, error) {
+	start := time.Now()
+	var conn net.Conn
+	var err error
+	if conf.proxy.Scheme == "http" {
+		conn, err = connectTunnel(ctx, conf.proxy, addr)
+	} else {
+		conn, err = socksTunnel(ctx, conf.proxy, addr)
+	}
+	atomic.AddInt64(&conf.stats.proxyNanos, int64(time.Since(start)))
+	atomic.AddInt64(&conf.stats.proxyConnects, 1)
+	if err != nil {
+		atomic.AddInt64(&conf.stats.proxyFails, 1)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// connectTunnel asks an HTTP proxy for a tunnel to addr using the CONNECT method
+func connectTunnel(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", proxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused tunnel to %s: %s", addr, resp.Status)
+	}
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// socksTunnel opens a connection to addr through a SOCKS5 proxy
+func socksTunnel(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		auth = &proxy.Auth{User: user.Username(), Password: password}
+	}
+	dialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, &net.Dialer{Timeout: dialTimeout})
+	if err != nil {
+		return nil, err
+	}
+	return dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+}
+
+// bufferedConn keeps bytes read past the proxy response, so they aren't lost to the client
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
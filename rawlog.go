@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported formats for raw result logs
+const (
+	rawJSONL string = "jsonl"
+	rawCSV   string = "csv"
+)
+
+var rawCSVHeader = []string{"id", "run", "start", "latency_ms", "status", "error", "bytes_in", "bytes_out", "endpoint", "worker", "trace_id", "warmup"}
+
+type rawRecord struct {
+	ID        string  `json:"id"`
+	Run       string  `json:"run"`
+	Start     string  `json:"start"`
+	LatencyMs float64 `json:"latency_ms"`
+	Status    int     `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	BytesIn   int     `json:"bytes_in"`
+	BytesOut  int     `json:"bytes_out"`
+	Endpoint  string  `json:"endpoint"`
+	Worker    int     `json:"worker"`
+	TraceID   string  `json:"trace_id,omitempty"`
+	Warmup    bool    `json:"warmup,omitempty"`
+}
+
+// rawLogger writes one line per request from its own goroutine,
+// buffering both the records in flight and the file writes.
+type rawLogger struct {
+	file    *os.File
+	buf     *bufio.Writer
+	csv     *csv.Writer
+	json    *json.Encoder
+	records chan rawRecord
+	done    chan struct{}
+}
+
+func newRawLogger(path string, format string) (*rawLogger, error) {
+	if format == "" {
+		format = rawJSONL
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = rawCSV
+		}
+	}
+	if format != rawJSONL && format != rawCSV {
+		return nil, fmt.Errorf("unknown raw log format: %q", format)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &rawLogger{
+		file:    file,
+		buf:     bufio.NewWriterSize(file, 1<<16),
+		records: make(chan rawRecord, 10000),
+		done:    make(chan struct{}),
+	}
+	if format == rawCSV {
+		l.csv = csv.NewWriter(l.buf)
+		if err := l.csv.Write(rawCSVHeader); err != nil {
+			return nil, err
+		}
+	} else {
+		l.json = json.NewEncoder(l.buf)
+	}
+
+	go l.run()
+	return l, nil
+}
+
+func (l *rawLogger) log(params *testParams, res respStatus) {
+	l.records <- rawRecord{
+		ID:        res.id,
+		Run:       params.runID,
+		Start:     res.start.Format(time.RFC3339Nano),
+		LatencyMs: float64(res.latency) / float64(time.Millisecond),
+		Status:    res.code,
+		Error:     res.err,
+		BytesIn:   res.bytesIn,
+		BytesOut:  res.bytesOut,
+		Endpoint:  res.endpoint,
+		Worker:    params.workerID,
+		TraceID:   res.traceID,
+		Warmup:    res.warmup,
+	}
+}
+
+func (l *rawLogger) run() {
+	defer close(l.done)
+	for r := range l.records {
+		var err error
+		if l.csv != nil {
+			err = l.csv.Write([]string{
+				r.ID, r.Run, r.Start, strconv.FormatFloat(r.LatencyMs, 'f', 3, 64), strconv.Itoa(r.Status),
+				r.Error, strconv.Itoa(r.BytesIn), strconv.Itoa(r.BytesOut), r.Endpoint, strconv.Itoa(r.Worker), r.TraceID,
+				strconv.FormatBool(r.Warmup),
+			})
+		} else {
+			err = l.json.Encode(r)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing raw log: %v\n", err)
+		}
+	}
+}
+
+// Close waits for every pending record to be written before closing the file
+func (l *rawLogger) Close() error {
+	close(l.records)
+	<-l.done
+	if l.csv != nil {
+		l.csv.Flush()
+	}
+	if err := l.buf.Flush(); err != nil {
+		return err
+	}
+	return l.file.Close()
+}
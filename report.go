@@ -0,0 +1,237 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+)
+
+type chartLine struct {
+	label  string
+	color  string
+	values []float64
+}
+
+const reportTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>blowhole report: {{.Name}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 1100px; color: #222; }
+h1 { border-bottom: 2px solid #222; padding-bottom: .3em; }
+h2 { margin-top: 2em; border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ddd; padding: .3em .8em; text-align: right; }
+th { background: #f4f4f4; }
+td.text, th.text { text-align: left; }
+.charts { display: flex; flex-wrap: wrap; gap: 1em; }
+.chart { border: 1px solid #ddd; padding: .5em; }
+.chart h4 { margin: 0 0 .3em 0; font-weight: normal; }
+.legend span { margin-right: 1em; }
+.bad { color: #b00; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{range matrixGroups .Runs}}{{with groupLabel .}}<h3>{{.}}</h3>
+{{end}}<table>
+<tr><th class="text">Run</th><th class="text">Label</th><th class="text">URL</th><th>Requests</th><th>Concurrency</th><th>Sent</th><th>Failed</th><th>RPS</th><th>p50 ms</th><th>p99 ms</th><th class="text">Started</th></tr>
+{{range .}}<tr><td class="text"><a href="#{{.RunID}}">{{.RunID}}</a></td><td class="text">{{.Label}}</td><td class="text">{{.URL}}</td><td>{{.Requests}}</td><td>{{.Concurrency}}</td><td>{{.Sent}}</td><td{{if .Failed}} class="bad"{{end}}>{{.Failed}}</td><td>{{printf "%.1f" .RPS}}</td><td>{{printf "%.2f" .Latency.P50}}</td><td>{{printf "%.2f" .Latency.P99}}</td><td class="text">{{.Start.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+{{end}}
+{{range .Runs}}
+<h2 id="{{.RunID}}">Run {{.RunID}}</h2>
+{{with .Label}}<p>{{.}}</p>{{end}}
+{{with .Group}}<p>Started together with the other runs of parallel group <code>{{.}}</code>.</p>{{end}}
+{{with .Skipped}}<p class="bad">Skipped: {{.}}</p>{{end}}
+<p>{{.Requests}} requests to <code>{{.URL}}</code> with {{.Concurrency}} concurrent users, in {{printf "%.2f" .Duration}}s.
+{{.BytesOut}} bytes sent, {{.BytesIn}} bytes received.</p>
+<h3>{{latencyLabel .}}</h3>
+<table>
+<tr><th>min</th><th>mean</th><th>p50</th><th>p90</th><th>p95</th><th>p99</th><th>max</th></tr>
+<tr><td>{{.Latency.Min}}</td><td>{{.Latency.Mean}}</td><td>{{.Latency.P50}}</td><td>{{.Latency.P90}}</td><td>{{.Latency.P95}}</td><td>{{.Latency.P99}}</td><td>{{.Latency.Max}}</td></tr>
+</table>
+{{if .GRPCCodes}}<h3>gRPC status codes</h3>
+<table>
+<tr>{{range $code, $count := .GRPCCodes}}<th>{{$code}}</th>{{end}}</tr>
+<tr>{{range .GRPCCodes}}<td>{{.}}</td>{{end}}</tr>
+</table>
+{{else}}<h3>Response codes</h3>
+<table>
+<tr><th>1xx</th><th>2xx</th><th>3xx</th><th>4xx</th><th>5xx</th><th>Unknown</th></tr>
+<tr>{{range .Codes}}<td>{{.}}</td>{{end}}</tr>
+</table>
+{{end}}
+{{with .Operations}}<h3>Operations</h3>
+<table>
+<tr><th class="text">Name</th><th>Requests</th><th>Failed</th><th>p50 ms</th><th>p90 ms</th><th>p99 ms</th></tr>
+{{$ops := .}}{{range $name := sortedOperations .}}{{$op := index $ops $name}}<tr><td class="text">{{$name}}</td><td>{{$op.Requests}}</td><td{{if $op.Failed}} class="bad"{{end}}>{{$op.Failed}}</td><td>{{$op.Latency.P50}}</td><td>{{$op.Latency.P90}}</td><td>{{$op.Latency.P99}}</td></tr>
+{{end}}</table>
+{{end}}
+{{with .WebSocket}}<h3>WebSocket connections</h3>
+<table>
+<tr><th>Connects</th><th>Failed</th><th>Disconnects</th><th>Connect p50 ms</th><th>Connect p99 ms</th><th class="text">Close codes</th></tr>
+<tr><td>{{.Connects}}</td><td>{{.ConnectFailures}}</td><td>{{.Disconnects}}</td><td>{{.ConnectLatency.P50}}</td><td>{{.ConnectLatency.P99}}</td><td class="text">{{range $code, $count := .CloseCodes}}{{$code}}: {{$count}} {{end}}</td></tr>
+</table>
+{{end}}
+{{with .SSE}}<h3>Event streams</h3>
+<table>
+<tr><th>Streams</th><th>Reconnects</th><th>Events</th><th>Events per stream</th><th>First event p50 ms</th><th>First event p99 ms</th></tr>
+<tr><td>{{.Streams}}</td><td>{{.Reconnects}}</td><td>{{.Events}}</td><td>{{printf "%.1f" .EventsPerStream}}</td><td>{{.TimeToFirstEvent.P50}}</td><td>{{.TimeToFirstEvent.P99}}</td></tr>
+</table>
+{{end}}
+{{with .Warmup}}<h3>Warm-up (excluded)</h3>
+<table>
+<tr><th>Requests</th><th>Duration s</th><th>2xx</th><th>Failed</th><th>p50 ms</th><th>p99 ms</th></tr>
+<tr><td>{{.Requests}}</td><td>{{printf "%.1f" .Duration}}</td><td>{{index .Codes 1}}</td><td{{if .Failed}} class="bad"{{end}}>{{.Failed}}</td><td>{{.Latency.P50}}</td><td>{{.Latency.P99}}</td></tr>
+</table>
+{{end}}
+{{with seriesCharts .}}<h3>Time series</h3>
+<div class="charts">{{range .}}{{.}}{{end}}</div>
+{{end}}
+{{with sortedErrors .Errors}}<h3>Errors</h3>
+<table>
+<tr><th>Count</th><th class="text">Error</th></tr>
+{{range .}}<tr><td>{{.Count}}</td><td class="text">{{.Message}}</td></tr>
+{{end}}</table>
+{{end}}
+{{end}}
+<p><small>Generated by blowhole</small></p>
+</body>
+</html>
+`
+
+type errorEntry struct {
+	Message string
+	Count   int
+}
+
+func sortedErrors(errors map[string]int) []errorEntry {
+	entries := make([]errorEntry, 0, len(errors))
+	for e, c := range errors {
+		entries = append(entries, errorEntry{Message: e, Count: c})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Message < entries[j].Message
+	})
+	return entries
+}
+
+func seriesCharts(r runResult) []template.HTML {
+	if len(r.Series) == 0 {
+		return nil
+	}
+	var xs []float64
+	rps := chartLine{label: "rps", color: "#1f77b4"}
+	p50 := chartLine{label: "p50", color: "#2ca02c"}
+	p90 := chartLine{label: "p90", color: "#ff7f0e"}
+	p99 := chartLine{label: "p99", color: "#d62728"}
+	errs := chartLine{label: "errors", color: "#d62728"}
+	non2xx := chartLine{label: "non-2xx", color: "#9467bd"}
+	for _, b := range r.Series {
+		xs = append(xs, b.Offset)
+		rps.values = append(rps.values, b.RPS)
+		p50.values = append(p50.values, b.Latency.P50)
+		p90.values = append(p90.values, b.Latency.P90)
+		p99.values = append(p99.values, b.Latency.P99)
+		errs.values = append(errs.values, float64(b.Errors))
+		non2xx.values = append(non2xx.values, float64(b.Requests-b.Codes[1]))
+	}
+	return []template.HTML{
+		svgChart("Requests per second", xs, rps),
+		svgChart(latencyLabel(r), xs, p50, p90, p99),
+		svgChart("Errors and non-2xx responses", xs, errs, non2xx),
+	}
+}
+
+// svgChart renders an inline SVG line chart, so reports have no external dependencies
+func svgChart(title string, xs []float64, lines ...chartLine) template.HTML {
+	const width, height, pad = 340.0, 180.0, 30.0
+
+	maxX, maxY := xs[len(xs)-1], 0.0
+	for _, l := range lines {
+		for _, v := range l.values {
+			if v > maxY {
+				maxY = v
+			}
+		}
+	}
+	if maxX == 0 {
+		maxX = 1
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<div class="chart"><h4>%s</h4><svg width="%g" height="%g" viewBox="0 0 %g %g">`,
+		template.HTMLEscapeString(title), width, height, width, height)
+	fmt.Fprintf(&sb, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="#999"/>`, pad, height-pad, width, height-pad)
+	fmt.Fprintf(&sb, `<line x1="%g" y1="0" x2="%g" y2="%g" stroke="#999"/>`, pad, pad, height-pad)
+	fmt.Fprintf(&sb, `<text x="0" y="10" font-size="10">%.4g</text>`, maxY)
+	fmt.Fprintf(&sb, `<text x="%g" y="%g" font-size="10" text-anchor="end">%gs</text>`, width, height-pad+12, maxX)
+	for _, l := range lines {
+		var points []string
+		for i, v := range l.values {
+			x := pad + xs[i]/maxX*(width-pad)
+			y := (height - pad) - v/maxY*(height-pad-5)
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		fmt.Fprintf(&sb, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`, l.color, strings.Join(points, " "))
+	}
+	sb.WriteString(`</svg><div class="legend">`)
+	for _, l := range lines {
+		fmt.Fprintf(&sb, `<span style="color:%s">&#9632; %s</span>`, l.color, template.HTMLEscapeString(l.label))
+	}
+	sb.WriteString(`</div></div>`)
+	return template.HTML(sb.String())
+}
+
+func writeHTMLReport(path string, result testResult) error {
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"latencyLabel":     latencyLabel,
+		"seriesCharts":     seriesCharts,
+		"sortedErrors":     sortedErrors,
+		"sortedOperations": sortedOperations,
+		"matrixGroups":     matrixGroups,
+		"groupLabel":       groupLabel,
+	}).Parse(reportTemplate)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return tmpl.Execute(file, result)
+}
+
+// reportCommand implements "blowhole report", rendering a saved JSON result as HTML
+func reportCommand(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	output := fs.String("o", "report.html", "string. Path of the HTML report to write")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: blowhole report [-o report.html] results.json\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	result, err := readJSONResult(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return writeHTMLReport(*output, result)
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// latencySummary holds latency statistics in milliseconds
+type latencySummary struct {
+	Min  float64 `json:"min_ms"`
+	Mean float64 `json:"mean_ms"`
+	P50  float64 `json:"p50_ms"`
+	P90  float64 `json:"p90_ms"`
+	P95  float64 `json:"p95_ms"`
+	P99  float64 `json:"p99_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+type seriesBucket struct {
+	Offset   float64        `json:"offset_s"`
+	Requests int            `json:"requests"`
+	RPS      float64        `json:"rps"`
+	Latency  latencySummary `json:"latency"`
+	Codes    [6]int         `json:"response_codes"`
+	Errors   int            `json:"errors"`
+
+	latencies []time.Duration
+}
+
+// operationStats holds stats for requests sharing an operation name
+type operationStats struct {
+	Step     int            `json:"step,omitempty"`
+	Requests int            `json:"requests"`
+	Failed   int            `json:"failed"`
+	Latency  latencySummary `json:"latency"`
+
+	latencies []time.Duration
+}
+
+type runResult struct {
+	Test        string        `json:"test"`
+	RunID       string        `json:"run_id"`
+	URL         string        `json:"url"`
+	Requests    int           `json:"requests"`
+	Concurrency int           `json:"concurrency"`
+	Label       string        `json:"label,omitempty"`
+	Params      []matrixParam `json:"params,omitempty"`
+	Group       string        `json:"parallel_group,omitempty"`
+	Skipped     string        `json:"skipped,omitempty"`
+	Start       time.Time     `json:"start"`
+	Duration    float64       `json:"duration_s"`
+	Sent        int           `json:"sent"`
+	RPS         float64       `json:"rps"`
+	Codes       [6]int        `json:"response_codes"`
+	Failed      int           `json:"failed"`
+	// Unsuccessful counts requests that failed or received a 5xx response once each
+	Unsuccessful int                        `json:"unsuccessful"`
+	Errors       map[string]int             `json:"errors,omitempty"`
+	GRPCCodes    map[string]int             `json:"grpc_codes,omitempty"`
+	BytesIn      int64                      `json:"bytes_in"`
+	BytesOut     int64                      `json:"bytes_out"`
+	Latency      latencySummary             `json:"latency"`
+	Connections  connSummary                `json:"connections"`
+	WebSocket    *wsSummary                 `json:"websocket,omitempty"`
+	SSE          *sseSummary                `json:"sse,omitempty"`
+	Warmup       *warmupSummary             `json:"warmup,omitempty"`
+	Operations   map[string]*operationStats `json:"operations,omitempty"`
+	Interval     float64                    `json:"interval_s,omitempty"`
+	Series       []seriesBucket             `json:"series,omitempty"`
+}
+
+// testResult is the JSON report written for a whole batch of runs
+type testResult struct {
+	Name string      `json:"name"`
+	Runs []runResult `json:"runs"`
+}
+
+// runStats collects latencies, bytes and time-series buckets for a single run.
+// It is only ever touched from statusWorker, so it needs no locking. The one exception is start,
+// which a warm-up phase resets before releasing users: see warmupPhase.begin.
+type runStats struct {
+	start        time.Time
+	end          time.Time
+	interval     time.Duration
+	latencies    []time.Duration
+	buckets      []*seriesBucket
+	bytesIn      int64
+	bytesOut     int64
+	failed       int
+	unsuccessful int
+	ops          map[string]*operationStats
+}
+
+func newRunStats(interval time.Duration) *runStats {
+	return &runStats{
+		start:    time.Now(),
+		interval: interval,
+	}
+}
+
+func (s *runStats) add(res respStatus) {
+	s.bytesIn += int64(res.bytesIn)
+	s.bytesOut += int64(res.bytesOut)
+	if res.err != "" {
+		s.failed++
+	}
+	if res.err != "" || statusClass(res.code) == 4 {
+		s.unsuccessful++
+	}
+	if res.code > 0 {
+		s.latencies = append(s.latencies, res.latency)
+	}
+	if res.operation != "" {
+		if s.ops == nil {
+			s.ops = make(map[string]*operationStats)
+		}
+		op, ok := s.ops[res.operation]
+		if !ok {
+			op = &operationStats{Step: res.step}
+			s.ops[res.operation] = op
+		}
+		op.Requests++
+		if res.err != "" {
+			op.Failed++
+		}
+		if res.code > 0 {
+			op.latencies = append(op.latencies, res.latency)
+		}
+	}
+
+	if s.interval <= 0 {
+		return
+	}
+	idx := int(res.start.Add(res.latency).Sub(s.start) / s.interval)
+	if idx < 0 {
+		idx = 0
+	}
+	for len(s.buckets) <= idx {
+		s.buckets = append(s.buckets, &seriesBucket{
+			Offset: (time.Duration(len(s.buckets)) * s.interval).Seconds(),
+		})
+	}
+	b := s.buckets[idx]
+	b.Requests++
+	b.Codes[statusClass(res.code)]++
+	if res.err != "" {
+		b.Errors++
+	}
+	if res.code > 0 {
+		b.latencies = append(b.latencies, res.latency)
+	}
+}
+
+// skippedRun records a run that wasn't performed because its setup failed
+func skippedRun(test string, plan runPlan, run runConf, reason error) runResult {
+	fmt.Printf("%s\nTest \"%s\" skipped - Run: %s\n%v\n%s\n", separator, test, plan.ID, reason, separator)
+	return runResult{
+		Test:        test,
+		RunID:       plan.ID,
+		URL:         plan.URL,
+		Requests:    plan.Requests,
+		Concurrency: plan.Concurrency,
+		Label:       run.Label,
+		Params:      run.Params,
+		Group:       plan.Group,
+		Start:       time.Now(),
+		Skipped:     reason.Error(),
+	}
+}
+
+func (s *runStats) result(params *testParams) runResult {
+	if s.end.IsZero() {
+		s.end = time.Now()
+	}
+	elapsed := s.end.Sub(s.start).Seconds()
+	r := runResult{
+		Test:         params.name,
+		RunID:        params.runID,
+		URL:          params.url,
+		Requests:     params.totalRequests,
+		Concurrency:  params.concurrentUsers,
+		Label:        params.label,
+		Params:       params.params,
+		Group:        params.group,
+		Start:        s.start,
+		Duration:     elapsed,
+		Codes:        params.responseCodes,
+		Failed:       s.failed,
+		Unsuccessful: s.unsuccessful,
+		Errors:       params.errorCount,
+		GRPCCodes:    params.grpcCodes,
+		BytesIn:      s.bytesIn,
+		BytesOut:     s.bytesOut,
+		Latency:      summarizeLatencies(s.latencies),
+		Interval:     s.interval.Seconds(),
+	}
+	for _, c := range r.Codes {
+		r.Sent += c
+	}
+	if params.conns != nil {
+		r.Connections = params.conns.summary()
+	}
+	if params.ws != nil {
+		r.WebSocket = params.ws.summary()
+	}
+	if params.sse != nil {
+		r.SSE = params.sse.summary()
+	}
+	if params.warmup != nil {
+		r.Warmup = params.warmup.summary()
+	}
+	for _, op := range s.ops {
+		op.Latency = summarizeLatencies(op.latencies)
+	}
+	r.Operations = s.ops
+	if elapsed > 0 {
+		r.RPS = float64(r.Sent) / elapsed
+	}
+	for i, b := range s.buckets {
+		// the last bucket is cut short by the end of the run
+		span := s.interval
+		if i == len(s.buckets)-1 {
+			if rest := s.end.Sub(s.start) - time.Duration(i)*s.interval; rest > 0 && rest < span {
+				span = rest
+			}
+		}
+		b.RPS = float64(b.Requests) / span.Seconds()
+		b.Latency = summarizeLatencies(b.latencies)
+		r.Series = append(r.Series, *b)
+	}
+	return r
+}
+
+// latencyLabel names what the latencies of a run measure
+func latencyLabel(r runResult) string {
+	if r.WebSocket != nil && !r.WebSocket.Replies {
+		return "Write time (ms)"
+	}
+	return "Latency (ms)"
+}
+
+// statusClass maps a status code to its index in responseCodes <[100s, 200s, 300s, 400s, 500s, unknowns]>
+func statusClass(code int) int {
+	if code >= 100 && code < 600 {
+		return code/100 - 1
+	}
+	return 5
+}
+
+// summarizeLatencies sorts the given latencies in place
+func summarizeLatencies(latencies []time.Duration) latencySummary {
+	if len(latencies) == 0 {
+		return latencySummary{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	return latencySummary{
+		Min:  toMillis(latencies[0]),
+		Mean: toMillis(total / time.Duration(len(latencies))),
+		P50:  toMillis(percentile(latencies, 50)),
+		P90:  toMillis(percentile(latencies, 90)),
+		P95:  toMillis(percentile(latencies, 95)),
+		P99:  toMillis(percentile(latencies, 99)),
+		Max:  toMillis(latencies[len(latencies)-1]),
+	}
+}
+
+// percentile uses the nearest-rank method on sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func toMillis(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+// sortedOperations returns operation names in scenario step order, then by name
+func sortedOperations(ops map[string]*operationStats) []string {
+	names := make([]string, 0, len(ops))
+	for name := range ops {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := ops[names[i]], ops[names[j]]
+		if a.Step != b.Step {
+			return a.Step < b.Step
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func printOperations(ops map[string]*operationStats) {
+	if len(ops) == 0 {
+		return
+	}
+	names := sortedOperations(ops)
+	fmt.Println("Operations:")
+	fmt.Printf("  %-24s %9s %9s %9s %9s\n", "name", "requests", "failed", "p50 ms", "p99 ms")
+	for _, name := range names {
+		op := ops[name]
+		fmt.Printf("  %-24s %9d %9d %9.2f %9.2f\n", name, op.Requests, op.Failed, op.Latency.P50, op.Latency.P99)
+	}
+}
+
+func printSeries(r runResult) {
+	if len(r.Series) == 0 {
+		return
+	}
+	fmt.Printf("Time series (%gs intervals):\n", r.Interval)
+	fmt.Printf("  %8s %8s %9s %9s %9s %6s %6s %6s %6s %6s\n", "time", "rps", "p50 ms", "p90 ms", "p99 ms", "2xx", "3xx", "4xx", "5xx", "errors")
+	for _, b := range r.Series {
+		fmt.Printf("  %7.1fs %8.0f %9.2f %9.2f %9.2f %6d %6d %6d %6d %6d\n",
+			b.Offset, b.RPS, b.Latency.P50, b.Latency.P90, b.Latency.P99, b.Codes[1], b.Codes[2], b.Codes[3], b.Codes[4], b.Errors)
+	}
+}
+
+func writeJSONResult(path string, result testResult) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func readJSONResult(path string) (testResult, error) {
+	var result testResult
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return result, err
+	}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+func writeSeriesCSV(path string, result testResult) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	err = w.Write([]string{"test", "run", "offset_s", "requests", "rps", "p50_ms", "p90_ms", "p99_ms", "max_ms",
+		"1xx", "2xx", "3xx", "4xx", "5xx", "unknown", "errors"})
+	if err != nil {
+		return err
+	}
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	for _, r := range result.Runs {
+		for _, b := range r.Series {
+			record := []string{result.Name, r.RunID, f(b.Offset), strconv.Itoa(b.Requests), f(b.RPS),
+				f(b.Latency.P50), f(b.Latency.P90), f(b.Latency.P99), f(b.Latency.Max)}
+			for _, c := range b.Codes {
+				record = append(record, strconv.Itoa(c))
+			}
+			record = append(record, strconv.Itoa(b.Errors))
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func ms(n ...int) []time.Duration {
+	var d []time.Duration
+	for _, v := range n {
+		d = append(d, time.Duration(v)*time.Millisecond)
+	}
+	return d
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{p: 0, want: time.Millisecond},
+		{p: 10, want: time.Millisecond},
+		{p: 11, want: 2 * time.Millisecond},
+		{p: 50, want: 5 * time.Millisecond},
+		{p: 90, want: 9 * time.Millisecond},
+		{p: 99, want: 10 * time.Millisecond},
+		{p: 100, want: 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeLatencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		want      latencySummary
+	}{
+		{name: "empty", want: latencySummary{}},
+		{name: "single", latencies: ms(7), want: latencySummary{Min: 7, Mean: 7, P50: 7, P90: 7, P95: 7, P99: 7, Max: 7}},
+		{
+			name:      "unsorted",
+			latencies: ms(40, 10, 30, 20),
+			want:      latencySummary{Min: 10, Mean: 25, P50: 20, P90: 40, P95: 40, P99: 40, Max: 40},
+		},
+		{
+			name:      "sub-millisecond",
+			latencies: []time.Duration{1500 * time.Microsecond, 500 * time.Microsecond},
+			want:      latencySummary{Min: 0.5, Mean: 1, P50: 0.5, P90: 1.5, P95: 1.5, P99: 1.5, Max: 1.5},
+		},
+	}
+	for _, tt := range tests {
+		if got := summarizeLatencies(tt.latencies); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRunStatsSeries(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		duration time.Duration
+		offsets  []time.Duration
+		want     []float64
+	}{
+		{
+			name:     "whole buckets",
+			duration: 2 * time.Second,
+			offsets:  []time.Duration{100 * time.Millisecond, 900 * time.Millisecond, 1500 * time.Millisecond},
+			want:     []float64{2, 1},
+		},
+		{
+			name:     "last bucket cut short",
+			duration: 2500 * time.Millisecond,
+			offsets:  []time.Duration{100 * time.Millisecond, 2100 * time.Millisecond, 2200 * time.Millisecond},
+			want:     []float64{1, 0, 4},
+		},
+		{
+			name:     "responses after the end keep the full interval",
+			duration: 500 * time.Millisecond,
+			offsets:  []time.Duration{100 * time.Millisecond, 1200 * time.Millisecond},
+			want:     []float64{1, 1},
+		},
+	}
+	for _, tt := range tests {
+		s := newRunStats(time.Second)
+		s.start = start
+		for _, off := range tt.offsets {
+			s.add(respStatus{code: 200, start: start.Add(off)})
+		}
+		s.end = start.Add(tt.duration)
+		r := s.result(&testParams{})
+		if len(r.Series) != len(tt.want) {
+			t.Fatalf("%s: got %d buckets, want %d", tt.name, len(r.Series), len(tt.want))
+		}
+		for i, b := range r.Series {
+			if b.RPS != tt.want[i] {
+				t.Errorf("%s: bucket %d RPS = %v, want %v", tt.name, i, b.RPS, tt.want[i])
+			}
+			if b.Offset != float64(i) {
+				t.Errorf("%s: bucket %d offset = %v", tt.name, i, b.Offset)
+			}
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// runEnv holds what the runs of a batch share
+type runEnv struct {
+	batch     *batchSpec
+	runc      int
+	tlsConfig *tls.Config
+	rawLog    *rawLogger
+	metrics   *metricsRegistry
+}
+
+// runBatch performs the runs of a validated batch in order, between the test-level hooks,
+// and writes the reports for all of them
+func runBatch(batch *batchSpec, runc int, tlsConfig *tls.Config) {
+	if batch.Output != "" {
+		file, err := os.OpenFile(batch.Output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		log.SetOutput(file)
+
+		initMessage = "test %s,%s,%d,%d"
+		resultMessage = "%d,%.0f,%[8]d"
+		grpcResultMessage = "%d,%.0f,%d,%s"
+	}
+
+	env := &runEnv{batch: batch, runc: runc, tlsConfig: tlsConfig}
+	if batch.RawLog != "" {
+		rawLog, err := newRawLogger(batch.RawLog, batch.RawFormat)
+		if err != nil {
+			log.Fatalf("Error opening raw log: %v\n", err)
+		}
+		defer func() {
+			if err := rawLog.Close(); err != nil {
+				log.Printf("Error closing raw log: %v\n", err)
+			}
+		}()
+		env.rawLog = rawLog
+	}
+	if batch.MetricsAddr != "" {
+		env.metrics = newMetricsRegistry()
+		stopMetrics := serveMetrics(batch.MetricsAddr, env.metrics)
+		defer stopMetrics()
+	}
+
+	result := testResult{Name: batch.Name}
+	testVars := make(map[string]string)
+	setupErr := runHooks("before test", batch.Before, testVars, tlsConfig)
+
+	var stopped error
+	for i := 0; i < len(batch.Runs); {
+		end := batch.groupEnd(i)
+		skip := setupErr
+		if skip == nil {
+			skip = stopped
+		}
+		plans, runs := runGroup(env, i, end, testVars, skip)
+		for k, r := range runs {
+			if r == nil {
+				continue
+			}
+			result.Runs = append(result.Runs, *r)
+			if stopped == nil && plans[k].StopOnFailure && r.failed() {
+				stopped = fmt.Errorf("stopped after run %s failed", r.RunID)
+			}
+		}
+		if skip == nil && stopped == nil {
+			pause("after", plans)
+		}
+		i = end
+	}
+
+	if err := runHooks("after test", batch.After, testVars, tlsConfig); err != nil {
+		log.Printf("Error in teardown: %v\n", err)
+	}
+
+	printMatrixSummary(result)
+	writeReports(batch, result)
+}
+
+// runGroup performs the runs of a batch from start to end, together if they are a parallel group, with their
+// run-level hooks. Runs are skipped if skip is set. Results are nil for runs performed in distributed mode.
+func runGroup(env *runEnv, start int, end int, testVars map[string]string, skip error) ([]runPlan, []*runResult) {
+	batch := env.batch
+	var plans []runPlan
+	for j := start; j < end; j++ {
+		plans = append(plans, batch.plan(j, env.runc))
+	}
+	if skip == nil {
+		pause("before", plans)
+	}
+
+	runs := make([]*runResult, end-start)
+	var started []*testParams
+	var startedAt []int
+	for k, plan := range plans {
+		run := batch.Runs[start+k]
+		if skip != nil {
+			skipped := skippedRun(batch.Name, plan, run, skip)
+			runs[k] = &skipped
+			continue
+		}
+		vars := copyVars(testVars)
+		if err := runHooks("before run", run.Before, vars, env.tlsConfig); err != nil {
+			skipped := skippedRun(batch.Name, plan, run, err)
+			runs[k] = &skipped
+			if err := runHooks("after run", run.After, vars, env.tlsConfig); err != nil {
+				log.Printf("Error in teardown: %v\n", err)
+			}
+			continue
+		}
+		started = append(started, newRunParams(env, plan, run, vars, len(plans) > 1))
+		startedAt = append(startedAt, k)
+	}
+
+	if len(started) > 1 {
+		for k, r := range startParallelRuns(batch.Runs[start].ParallelGroup, started) {
+			r := r
+			runs[startedAt[k]] = &r
+		}
+	} else if len(started) == 1 {
+		params := started[0]
+		if params.master {
+			startDistributedTest(params)
+		} else if params.worker {
+			startDistributedWorker(params)
+		} else {
+			r := startLumpedTest(params)
+			runs[startedAt[0]] = &r
+		}
+	}
+	for k, params := range started {
+		if params.metrics != nil {
+			params.metrics.endRun(params.name, params.runID)
+		}
+		if params.grpc != nil {
+			if err := params.grpc.close(); err != nil {
+				log.Printf("Error closing gRPC connection: %v\n", err)
+			}
+		}
+		if err := runHooks("after run", batch.Runs[start+startedAt[k]].After, params.vars, env.tlsConfig); err != nil {
+			log.Printf("Error in teardown: %v\n", err)
+		}
+	}
+	return plans, runs
+}
+
+// newRunParams sets up the target and the client of a run. Runs in a parallel group share
+// the terminal, so their progress bars are not shown.
+func newRunParams(env *runEnv, plan runPlan, run runConf, vars map[string]string, quiet bool) *testParams {
+	batch := env.batch
+	var pbarOut io.Writer = os.Stdout
+	if quiet {
+		pbarOut = io.Discard
+	}
+	conns := &connStats{}
+	proxy, err := parseProxyURL(plan.Proxy)
+	if err != nil {
+		log.Fatalf("Error parsing proxy URL: %v\n", err)
+	}
+	conf := clientConf{
+		protocol:   plan.Protocol,
+		target:     plan.URL,
+		options:    plan.Client,
+		tlsConfig:  env.tlsConfig,
+		stats:      conns,
+		unixSocket: plan.UnixSocket,
+		dialAddr:   plan.Dial,
+		proxy:      proxy,
+	}
+	client, err := newTargetClient(conf)
+	if err != nil {
+		log.Fatalf("Error creating client: %v\n", err)
+	}
+
+	params := &testParams{
+		name:            batch.Name,
+		client:          client,
+		conns:           conns,
+		url:             plan.URL,
+		rateLimit:       0,
+		concurrentUsers: run.Concurrency,
+		responseCodes:   [6]int{},
+		totalRequests:   run.Requests,
+		statusChan:      make(chan respStatus, 1000),
+		errorCount:      make(map[string]int),
+		grpcCodes:       make(map[string]int),
+		userCount:       0,
+		master:          batch.IsDistributed && !batch.IsWorker,
+		worker:          batch.IsDistributed && batch.IsWorker,
+		expectedWorkers: 2,
+		pbar: progressbar.NewOptions(run.Requests,
+			progressbar.OptionSetWriter(pbarOut),
+			progressbar.OptionEnableColorCodes(true),
+			progressbar.OptionShowIts(),
+			progressbar.OptionSetWidth(len(separator)),
+			progressbar.OptionShowCount(),
+			progressbar.OptionSetItsString("requests"),
+			progressbar.OptionShowElapsedTimeOnFinish(),
+		),
+		rps:     0,
+		rawLog:  env.rawLog,
+		metrics: env.metrics,
+	}
+
+	params.stats = newRunStats(batch.Interval)
+	if run.Interval != 0 {
+		params.stats.interval = run.Interval
+	}
+
+	params.runID = plan.ID
+	params.vars = vars
+	params.headers, err = newHeaderTemplates(plan.Headers)
+	if err != nil {
+		log.Fatalf("Error parsing headers: %v\n", err)
+	}
+	if strings.Contains(plan.URL, "{{") {
+		params.urlTemplate, err = newRequestTemplate("url", plan.URL)
+		if err != nil {
+			log.Fatalf("Error parsing URL template: %v\n", err)
+		}
+	}
+	for j, spec := range run.Feeders {
+		f, err := newFeeder(spec)
+		if err != nil {
+			log.Fatalf("Error loading feeder %s: %v\n", spec.label(j), err)
+		}
+		params.feeders = append(params.feeders, f)
+	}
+	params.label = run.Label
+	params.group = plan.Group
+	params.params = run.Params
+	params.runType = plan.Type
+	setupTarget(env, params, plan, run, conf)
+
+	params.idName = plan.IDHeader
+	params.idLocation = plan.IDLocation
+	switch params.idLocation {
+	case idInHeader, idInQuery, idInBody:
+	default:
+		log.Fatalf("Unknown id location: %q\n", params.idLocation)
+	}
+	if params.graphql != nil && params.idLocation == idInBody {
+		log.Fatalf("The id can't be sent in the body of GraphQL requests, use a header or a query parameter instead\n")
+	}
+	if params.sse != nil && params.idLocation == idInBody {
+		log.Fatalf("The id can't be sent in the body of SSE requests, use a header or a query parameter instead\n")
+	}
+	format, err := parseIDFormat(plan.IDFormat)
+	if err != nil {
+		log.Fatalf("Error parsing id format: %v\n", err)
+	}
+	// workers widen the format once they get their share of users from the coordinator
+	params.idFormat = format
+	if !params.worker {
+		params.idFormat = format.widen(run.Concurrency,
+			largestShare(run.Requests, run.Concurrency)+largestShare(plan.WarmupRequests, run.Concurrency))
+	}
+
+	params.trace, err = parseTraceConf(plan.Trace, override(run.TraceState, batch.TraceState))
+	if err != nil {
+		log.Fatalf("Error parsing trace options: %v\n", err)
+	}
+
+	if !params.master && !params.worker {
+		params.warmup = newWarmupPhase(plan.Warmup, plan.WarmupRequests)
+	}
+
+	if params.metrics != nil {
+		params.metrics.startRun(params.name, params.runID)
+	}
+	return params
+}
+
+// setupTarget sets up what sends the requests of a run, depending on its type
+func setupTarget(env *runEnv, params *testParams, plan runPlan, run runConf, conf clientConf) {
+	batch := env.batch
+	timeout := plan.Client.ReadTimeout + plan.Client.WriteTimeout
+	var err error
+	switch params.runType {
+	case runHTTP:
+		if len(run.Scenario) > 0 {
+			params.scenario, err = newScenario(plan.URL, run.Scenario, plan.IDLocation == idInBody)
+			if err != nil {
+				log.Fatalf("Error parsing scenario: %v\n", err)
+			}
+		} else if body := override(run.Body, batch.Body); body != "" {
+			params.body, err = newRequestTemplate("body", body)
+			if err != nil {
+				log.Fatalf("Error parsing body template: %v\n", err)
+			}
+		}
+	case runGRPC:
+		params.grpc, err = newGRPCTarget(grpcOptions{
+			target:    params.url,
+			method:    override(run.Method, batch.Method),
+			protoSet:  batch.ProtoSet,
+			body:      override(run.Body, batch.Body),
+			timeout:   timeout,
+			tlsConfig: env.tlsConfig,
+			dial:      conf.dialTarget,
+		})
+		if err != nil {
+			log.Fatalf("Error setting up gRPC target: %v\n", err)
+		}
+	case runGraphQL:
+		params.graphql, err = newGraphQLTarget(override(run.Query, batch.Query), override(run.Variables, batch.Variables),
+			override(run.Operation, batch.Operation))
+		if err != nil {
+			log.Fatalf("Error setting up GraphQL target: %v\n", err)
+		}
+	case runWebSocket:
+		params.ws, err = newWSTarget(wsOptions{
+			rate:      plan.WSRate,
+			waitReply: batch.WSReply,
+			message:   override(run.Body, batch.Body),
+			timeout:   timeout,
+			tlsConfig: env.tlsConfig,
+			dial:      conf.dialTarget,
+		})
+		if err != nil {
+			log.Fatalf("Error setting up WebSocket target: %v\n", err)
+		}
+	case runSSE:
+		var forwardProxy *url.URL
+		if forwardsRequests(conf.proxy, plan.URL) {
+			forwardProxy = conf.proxy
+		}
+		params.sse, err = newSSETarget(plan.SSEDuration, timeout, env.tlsConfig, conf.dialTarget, forwardProxy)
+		if err != nil {
+			log.Fatalf("Error setting up SSE target: %v\n", err)
+		}
+	default:
+		log.Fatalf("Unknown run type: %q\n", params.runType)
+	}
+}
+
+// writeReports writes the JSON, HTML and time-series reports set for a batch
+func writeReports(batch *batchSpec, result testResult) {
+	if batch.JSONReport != "" {
+		if err := writeJSONResult(batch.JSONReport, result); err != nil {
+			log.Printf("Error writing JSON report: %v\n", err)
+		}
+	}
+	if batch.HTMLReport != "" {
+		if err := writeHTMLReport(batch.HTMLReport, result); err != nil {
+			log.Printf("Error writing HTML report: %v\n", err)
+		}
+	}
+	if batch.SeriesFile != "" {
+		if err := writeSeriesCSV(batch.SeriesFile, result); err != nil {
+			log.Printf("Error writing time series: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// scenarioStep is a request in a sequence sent by each user, such as login, list, get item and update.
+// Strings in steps are templates that can use values extracted from the responses to earlier steps.
+type scenarioStep struct {
+	Name         string            `yaml:"name"`
+	Method       string            `yaml:"method"`
+	URL          string            `yaml:"url"`
+	Headers      map[string]string `yaml:"headers"`
+	Body         string            `yaml:"body"`
+	ExpectStatus int               `yaml:"expect_status"`
+	Extract      []extractSpec     `yaml:"extract"`
+}
+
+// extractSpec stores a value from a response in a variable, taken from one of: a JSON path in the body,
+// the first group of a regular expression matching the body, a header or a cookie
+type extractSpec struct {
+	Var    string `yaml:"var"`
+	JSON   string `yaml:"json"`
+	Regex  string `yaml:"regex"`
+	Header string `yaml:"header"`
+	Cookie string `yaml:"cookie"`
+}
+
+// scenario is the compiled sequence of steps of a run
+type scenario struct {
+	steps []*step
+}
+
+type step struct {
+	name         string
+	method       string
+	url          *requestTemplate
+	headers      []headerTemplate
+	body         *requestTemplate
+	expectStatus int
+	extract      []extractor
+}
+
+type extractor struct {
+	name   string
+	json   []string
+	regex  *regexp.Regexp
+	header string
+	cookie string
+}
+
+// newScenario compiles the steps of a run. Step URLs default to the run URL, and paths starting
+// with a slash are sent to the host of the run URL. bodyID tells whether the id is sent in the
+// request body, which makes POST the default method of every step.
+func newScenario(target string, steps []scenarioStep, bodyID bool) (*scenario, error) {
+	base, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	s := &scenario{}
+	names := make(map[string]bool)
+	for i, spec := range steps {
+		st, err := newStep(i, spec, base, target, bodyID)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %v", stepLabel(i, spec.Name), err)
+		}
+		if names[st.name] {
+			return nil, fmt.Errorf("step %s: duplicate step name", stepLabel(i, spec.Name))
+		}
+		names[st.name] = true
+		s.steps = append(s.steps, st)
+	}
+	return s, nil
+}
+
+func stepLabel(i int, name string) string {
+	if name != "" {
+		return fmt.Sprintf("%q", name)
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+func newStep(i int, spec scenarioStep, base *url.URL, target string, bodyID bool) (*step, error) {
+	st := &step{
+		name:         override(spec.Name, fmt.Sprintf("step %d", i+1)),
+		method:       strings.ToUpper(spec.Method),
+		expectStatus: spec.ExpectStatus,
+	}
+	if st.method == "" {
+		st.method = fasthttp.MethodGet
+		if spec.Body != "" || bodyID {
+			st.method = fasthttp.MethodPost
+		}
+	}
+
+	rawURL := override(spec.URL, target)
+	if strings.HasPrefix(rawURL, "/") {
+		rawURL = base.Scheme + "://" + base.Host + rawURL
+	}
+	var err error
+	if st.url, err = newRequestTemplate("url", rawURL); err != nil {
+		return nil, err
+	}
+	if spec.Body != "" {
+		if st.body, err = newRequestTemplate("body", spec.Body); err != nil {
+			return nil, err
+		}
+	}
+	if st.headers, err = newHeaderTemplates(spec.Headers); err != nil {
+		return nil, err
+	}
+
+	for _, e := range spec.Extract {
+		if !captureName.MatchString(e.Var) || reservedVars[e.Var] {
+			return nil, fmt.Errorf("invalid extract variable name: %q", e.Var)
+		}
+		x := extractor{name: e.Var, header: e.Header, cookie: e.Cookie}
+		sources := 0
+		if e.JSON != "" {
+			x.json = jsonPath(e.JSON)
+			sources++
+		}
+		if e.Regex != "" {
+			if x.regex, err = regexp.Compile(e.Regex); err != nil {
+				return nil, fmt.Errorf("extract %s: %v", e.Var, err)
+			}
+			sources++
+		}
+		if e.Header != "" {
+			sources++
+		}
+		if e.Cookie != "" {
+			sources++
+		}
+		if sources != 1 {
+			return nil, fmt.Errorf("extract %s: set exactly one of json, regex, header or cookie", e.Var)
+		}
+		st.extract = append(st.extract, x)
+	}
+	return st, nil
+}
+
+// jsonPath splits paths such as $.data.items[0].id into keys and indexes
+func jsonPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.ReplaceAll(path, "[", ".")
+	path = strings.ReplaceAll(path, "]", "")
+	return strings.Split(path, ".")
+}
+
+// names returns the step names in order, for run plans
+func (s *scenario) names() []string {
+	names := make([]string, len(s.steps))
+	for i, st := range s.steps {
+		names[i] = st.name
+	}
+	return names
+}
+
+// run sends the steps of the scenario in order for one iteration of a user, calling emit with the result
+// of each step. The remaining steps are skipped once a step fails, as they may depend on its values.
+func (s *scenario) run(params *testParams, info reqInfo, emit func(respStatus)) {
+	vars := templateVars(params, info)
+	for i, st := range s.steps {
+		res := st.send(params, info, i, vars)
+		emit(res)
+		if res.err != "" {
+			return
+		}
+	}
+}
+
+func (st *step) send(params *testParams, info reqInfo, i int, vars map[string]string) (res respStatus) {
+	res.id = info.id + ".S" + strconv.Itoa(i+1)
+	res.operation = st.name
+	res.step = i + 1
+	fail := func(err error) respStatus {
+		if res.code == 0 {
+			res.code = -1
+		}
+		res.err = err.Error()
+		return res
+	}
+
+	uri, err := st.url.render(vars)
+	if err != nil {
+		return fail(err)
+	}
+	res.endpoint = uri
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI(uri)
+	req.Header.SetMethod(st.method)
+	switch params.idLocation {
+	case idInQuery:
+		req.URI().QueryArgs().Set(params.idName, res.id)
+	case idInBody:
+		req.Header.SetContentType("application/json")
+		req.SetBody(idBody(params.idName, res.id))
+	default:
+		req.Header.Set(params.idName, res.id)
+	}
+	if st.body != nil {
+		body, err := st.body.render(vars)
+		if err != nil {
+			return fail(err)
+		}
+		req.Header.SetContentType("application/json")
+		req.SetBody([]byte(body))
+	}
+	for _, headers := range [][]headerTemplate{params.headers, st.headers} {
+		if err := setHeaders(headers, vars, req.Header.Set); err != nil {
+			return fail(err)
+		}
+	}
+	if params.trace.enabled() {
+		// steps of an iteration share a trace, each with its own span
+		res.traceID, _ = traceIDs(params.runID, params.workerID, info.userID, info.count)
+		_, spanID := traceIDs(res.id, params.workerID, info.userID, info.count)
+		params.trace.apply(&req.Header, res.traceID, spanID)
+	}
+	res.bytesOut = len(req.Header.Header()) + len(req.Body())
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	if params.metrics != nil {
+		params.metrics.requestSent(params.name, params.runID)
+		defer params.metrics.requestFinished(params.name, params.runID)
+	}
+	res.start = time.Now()
+	err = params.client.Do(req, resp)
+	res.latency = time.Since(res.start)
+	if err != nil {
+		return fail(err)
+	}
+	res.code = resp.StatusCode()
+	res.bytesIn = len(resp.Header.Header()) + len(resp.Body())
+	if st.expectStatus != 0 && res.code != st.expectStatus {
+		return fail(fmt.Errorf("expected status %d, got %d", st.expectStatus, res.code))
+	}
+
+	for _, x := range st.extract {
+		value, err := x.from(resp)
+		if err != nil {
+			return fail(fmt.Errorf("extract %s: %v", x.name, err))
+		}
+		vars[x.name] = value
+	}
+	return res
+}
+
+func (x extractor) from(resp *fasthttp.Response) (string, error) {
+	switch {
+	case x.header != "":
+		if v := resp.Header.Peek(x.header); v != nil {
+			return string(v), nil
+		}
+		return "", fmt.Errorf("no %s header", x.header)
+	case x.cookie != "":
+		c := fasthttp.AcquireCookie()
+		defer fasthttp.ReleaseCookie(c)
+		c.SetKey(x.cookie)
+		if resp.Header.Cookie(c) {
+			return string(c.Value()), nil
+		}
+		return "", fmt.Errorf("no %s cookie", x.cookie)
+	case x.regex != nil:
+		m := x.regex.FindSubmatch(resp.Body())
+		if m == nil {
+			return "", errors.New("no match")
+		}
+		if len(m) > 1 {
+			return string(m[1]), nil
+		}
+		return string(m[0]), nil
+	default:
+		var doc interface{}
+		if err := json.Unmarshal(resp.Body(), &doc); err != nil {
+			return "", err
+		}
+		for _, key := range x.json {
+			switch v := doc.(type) {
+			case map[string]interface{}:
+				doc = v[key]
+			case []interface{}:
+				n, err := strconv.Atoi(key)
+				if err != nil || n < 0 || n >= len(v) {
+					return "", fmt.Errorf("no index %s", key)
+				}
+				doc = v[n]
+			default:
+				doc = nil
+			}
+			if doc == nil {
+				return "", fmt.Errorf("no value at %s", strings.Join(x.json, "."))
+			}
+		}
+		if s, ok := doc.(string); ok {
+			return s, nil
+		}
+		text, err := json.Marshal(doc)
+		return string(text), err
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestJSONPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "$.data.token", want: []string{"data", "token"}},
+		{path: "data.token", want: []string{"data", "token"}},
+		{path: "$.items[0].id", want: []string{"items", "0", "id"}},
+		{path: "items[1][2]", want: []string{"items", "1", "2"}},
+	}
+	for _, tt := range tests {
+		if got := jsonPath(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("jsonPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	resp := &fasthttp.Response{}
+	resp.SetBody([]byte(`{"data": {"token": "tok-1", "n": 7, "ok": true}, "items": [{"id": 7, "href": "/items/7"}, {"id": 9}]}`))
+	resp.Header.Set("X-Req", "r-1")
+	c := fasthttp.AcquireCookie()
+	c.SetKey("session")
+	c.SetValue("s123")
+	resp.Header.SetCookie(c)
+	fasthttp.ReleaseCookie(c)
+
+	tests := []struct {
+		spec    extractSpec
+		want    string
+		wantErr string
+	}{
+		{spec: extractSpec{JSON: "$.data.token"}, want: "tok-1"},
+		{spec: extractSpec{JSON: "data.n"}, want: "7"},
+		{spec: extractSpec{JSON: "data.ok"}, want: "true"},
+		{spec: extractSpec{JSON: "$.items[1].id"}, want: "9"},
+		{spec: extractSpec{JSON: "items[0]"}, want: `{"href":"/items/7","id":7}`},
+		{spec: extractSpec{JSON: "items[2].id"}, wantErr: "no index 2"},
+		{spec: extractSpec{JSON: "data.missing"}, wantErr: "no value at data.missing"},
+		{spec: extractSpec{Regex: `"href": "([^"]+)"`}, want: "/items/7"},
+		{spec: extractSpec{Regex: `tok-\d`}, want: "tok-1"},
+		{spec: extractSpec{Regex: `nope`}, wantErr: "no match"},
+		{spec: extractSpec{Header: "X-Req"}, want: "r-1"},
+		{spec: extractSpec{Header: "X-Missing"}, wantErr: "no X-Missing header"},
+		{spec: extractSpec{Cookie: "session"}, want: "s123"},
+		{spec: extractSpec{Cookie: "other"}, wantErr: "no other cookie"},
+	}
+	for _, tt := range tests {
+		tt.spec.Var = "V"
+		s, err := newScenario("http://target/", []scenarioStep{{Extract: []extractSpec{tt.spec}}}, false)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.spec, err)
+		}
+		got, err := s.steps[0].extract[0].from(resp)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%+v: got error %v, want %q", tt.spec, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%+v: got %q (%v), want %q", tt.spec, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewScenario(t *testing.T) {
+	s, err := newScenario("http://target:8080/base?q=1", []scenarioStep{
+		{Name: "login", URL: "/login", Body: "{}"},
+		{URL: "/items/{{.ITEM}}"},
+		{Method: "put", URL: "http://other/x"},
+		{},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		method string
+		url    string
+	}{
+		{"login", "POST", "http://target:8080/login"},
+		{"step 2", "GET", "http://target:8080/items/{{.ITEM}}"},
+		{"step 3", "PUT", "http://other/x"},
+		{"step 4", "GET", "http://target:8080/base?q=1"},
+	}
+	for i, tt := range tests {
+		st := s.steps[i]
+		if st.name != tt.name || st.method != tt.method || st.url.text != tt.url {
+			t.Errorf("step %d: got %q %s %s, want %q %s %s", i+1, st.name, st.method, st.url.text, tt.name, tt.method, tt.url)
+		}
+	}
+
+	// with the id in the body, steps are sent with POST unless they set a method
+	s, err = newScenario("http://target/", []scenarioStep{{}, {Method: "get"}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.steps[0].method != "POST" || s.steps[1].method != "GET" {
+		t.Errorf("id in body: got methods %s and %s, want POST and GET", s.steps[0].method, s.steps[1].method)
+	}
+
+	for _, steps := range [][]scenarioStep{
+		{{Name: "a"}, {Name: "a"}},
+		{{Extract: []extractSpec{{Var: "X", JSON: "a", Regex: "b"}}}},
+		{{Extract: []extractSpec{{Var: "X"}}}},
+		{{Extract: []extractSpec{{Var: "ID", JSON: "a"}}}},
+		{{Extract: []extractSpec{{Var: "X", Regex: "("}}}},
+		{{URL: "/{{.X"}},
+	} {
+		if _, err := newScenario("http://target/", steps, false); err == nil {
+			t.Errorf("%+v: expected an error", steps)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outputMu keeps the output of runs in a parallel group from interleaving
+var outputMu sync.Mutex
+
+// expandRepeats replaces each run with a repeat count by that many copies, labeled with their repetition.
+// origins is updated to keep pointing at the runs each copy comes from in the file.
+func (conf *batchSpec) expandRepeats(origins []int) []int {
+	var runs []runConf
+	var expanded []int
+	for i, run := range conf.Runs {
+		if run.Repeat <= 1 {
+			runs = append(runs, run)
+			expanded = append(expanded, origins[i])
+			continue
+		}
+		for n := 1; n <= run.Repeat; n++ {
+			r := run
+			suffix := fmt.Sprintf("repeat %d/%d", n, run.Repeat)
+			r.Label = suffix
+			if run.Label != "" {
+				r.Label = run.Label + " (" + suffix + ")"
+			}
+			if run.CustomID != "" {
+				r.CustomID = run.CustomID + "-" + strconv.Itoa(n)
+			}
+			runs = append(runs, r)
+			expanded = append(expanded, origins[i])
+		}
+	}
+	conf.Runs = runs
+	return expanded
+}
+
+// groupEnd returns the index following the last run of the parallel group starting at run i.
+// Runs without a group are a group of their own.
+func (conf *batchSpec) groupEnd(i int) int {
+	group := conf.Runs[i].ParallelGroup
+	j := i + 1
+	for group != "" && j < len(conf.Runs) && conf.Runs[j].ParallelGroup == group {
+		j++
+	}
+	return j
+}
+
+// pause waits for the longest pause of a set of runs, e.g. to let target queues drain between runs
+func pause(stage string, plans []runPlan) {
+	var d time.Duration
+	var ids []string
+	for _, p := range plans {
+		v := p.PauseBefore
+		if stage == "after" {
+			v = p.PauseAfter
+		}
+		if v > d {
+			d = v
+		}
+		ids = append(ids, p.ID)
+	}
+	if d <= 0 {
+		return
+	}
+	fmt.Printf("Pausing for %s %s run %s\n", d, stage, strings.Join(ids, ", "))
+	time.Sleep(d)
+}
+
+// failed tells whether a run counts as failed for stop_on_failure: it was skipped,
+// or requests failed or received a 5xx response
+func (r runResult) failed() bool {
+	return r.Skipped != "" || r.Unsuccessful > 0
+}
+
+// startParallelRuns starts runs together and waits for all of them to finish
+func startParallelRuns(group string, runs []*testParams) []runResult {
+	var ids []string
+	for _, params := range runs {
+		ids = append(ids, params.runID)
+	}
+	fmt.Printf("%s\nParallel group %q starting - Runs: %s\n", separator, group, strings.Join(ids, ", "))
+
+	results := make([]runResult, len(runs))
+	var wg sync.WaitGroup
+	for i, params := range runs {
+		wg.Add(1)
+		go func(i int, params *testParams) {
+			defer wg.Done()
+			results[i] = startLumpedTest(params)
+		}(i, params)
+	}
+	wg.Wait()
+	printGroupSummary(group, results)
+	return results
+}
+
+// printGroupSummary prints the results of runs in a parallel group side by side
+func printGroupSummary(group string, runs []runResult) {
+	fmt.Printf("Parallel group %q results\n", group)
+	fmt.Printf("  %-10s %-32s %10s %8s %10s %10s\n", "Run", "URL", "RPS", "Failed", "p50 ms", "p99 ms")
+	for _, r := range runs {
+		fmt.Printf("  %-10s %-32s %10.1f %8d %10.2f %10.2f\n", r.RunID, r.URL, r.RPS, r.Failed, r.Latency.P50, r.Latency.P99)
+	}
+	fmt.Println(separator)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandRepeats(t *testing.T) {
+	conf := batchSpec{Runs: []runConf{
+		{Requests: 1},
+		{Requests: 2, Repeat: 3, Label: "soak", CustomID: "soak"},
+		{Requests: 3, Repeat: 1},
+		{Requests: 4, Repeat: 2},
+	}}
+	origins := conf.expandRepeats([]int{0, 1, 2, -1})
+	if want := []int{0, 1, 1, 1, 2, -1, -1}; !reflect.DeepEqual(origins, want) {
+		t.Errorf("origins = %v, want %v", origins, want)
+	}
+
+	tests := []struct {
+		label    string
+		id       string
+		requests int
+	}{
+		{"", "", 1},
+		{"soak (repeat 1/3)", "soak-1", 2},
+		{"soak (repeat 2/3)", "soak-2", 2},
+		{"soak (repeat 3/3)", "soak-3", 2},
+		{"", "", 3},
+		{"repeat 1/2", "", 4},
+		{"repeat 2/2", "", 4},
+	}
+	if len(conf.Runs) != len(tests) {
+		t.Fatalf("got %d runs, want %d", len(conf.Runs), len(tests))
+	}
+	for i, tt := range tests {
+		r := conf.Runs[i]
+		if r.Label != tt.label || r.CustomID != tt.id || r.Requests != tt.requests {
+			t.Errorf("run %d: got label %q, id %q, requests %d, want %q, %q, %d", i, r.Label, r.CustomID, r.Requests, tt.label, tt.id, tt.requests)
+		}
+	}
+}
+
+func TestGroupEnd(t *testing.T) {
+	conf := batchSpec{Runs: []runConf{
+		{},
+		{ParallelGroup: "a"},
+		{ParallelGroup: "a"},
+		{ParallelGroup: "a"},
+		{ParallelGroup: "b"},
+		{},
+		{},
+		{ParallelGroup: "c"},
+	}}
+	tests := []struct {
+		start int
+		want  int
+	}{
+		{start: 0, want: 1},
+		{start: 1, want: 4},
+		{start: 2, want: 4},
+		{start: 4, want: 5},
+		{start: 5, want: 6},
+		{start: 7, want: 8},
+	}
+	for _, tt := range tests {
+		if got := conf.groupEnd(tt.start); got != tt.want {
+			t.Errorf("groupEnd(%d) = %d, want %d", tt.start, got, tt.want)
+		}
+	}
+}
+
+func TestRunFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		r    runResult
+		want bool
+	}{
+		{name: "successful", r: runResult{Sent: 10, Codes: [6]int{0, 8, 0, 2, 0, 0}}, want: false},
+		{name: "skipped", r: runResult{Skipped: "hook failed"}, want: true},
+		{name: "unsuccessful requests", r: runResult{Sent: 10, Unsuccessful: 1}, want: true},
+	}
+	for _, tt := range tests {
+		if got := tt.r.failed(); got != tt.want {
+			t.Errorf("%s: failed() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
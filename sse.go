@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const runSSE string = "sse"
+
+const sseDefaultRetry = time.Second
+
+// sseTarget holds one Server-Sent Events stream per request for a fixed duration, reconnecting when streams end early
+type sseTarget struct {
+	client   *http.Client
+	duration time.Duration
+
+	mu           sync.Mutex
+	streams      int
+	reconnects   int
+	events       int
+	firstEventAt []time.Duration
+}
+
+type sseSummary struct {
+	Streams          int            `json:"streams"`
+	Reconnects       int            `json:"reconnects"`
+	Events           int            `json:"events"`
+	EventsPerStream  float64        `json:"events_per_stream"`
+	TimeToFirstEvent latencySummary `json:"time_to_first_event"`
+}
+
+func newSSETarget(duration time.Duration, connectTimeout time.Duration, tlsConfig *tls.Config, dial dialFunc, forwardProxy *url.URL) (*sseTarget, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("a positive stream duration is required for SSE runs")
+	}
+	transport := &http.Transport{
+		TLSClientConfig:       tlsConfig.Clone(),
+		ResponseHeaderTimeout: connectTimeout,
+		MaxIdleConnsPerHost:   -1,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dial(ctx, addr)
+		},
+	}
+	if forwardProxy != nil {
+		// plain http streams are sent to HTTP proxies in absolute form rather than tunneled
+		transport.Proxy = http.ProxyURL(forwardProxy)
+		transport.DialContext = (&net.Dialer{Timeout: dialTimeout}).DialContext
+	}
+	return &sseTarget{
+		client:   &http.Client{Transport: transport},
+		duration: duration,
+	}, nil
+}
+
+// session opens a stream and holds it until the configured duration has passed.
+// Latency is the time to the first event, or the whole session if no events were received.
+func (t *sseTarget) session(params *testParams, info reqInfo) (res respStatus) {
+	res.id = info.id
+	target, err := renderURL(params, info)
+	if err != nil {
+		res.code = -1
+		res.err = err.Error()
+		return
+	}
+	res.endpoint = target
+	res.start = time.Now()
+	deadline := res.start.Add(t.duration)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	if params.metrics != nil {
+		params.metrics.requestSent(params.name, params.runID)
+		defer params.metrics.requestFinished(params.name, params.runID)
+	}
+
+	var lastEventID string
+	var lastErr error
+	retry := sseDefaultRetry
+	connected := false
+	for attempt := 0; time.Now().Before(deadline); attempt++ {
+		if attempt > 0 {
+			// retries before the stream was first established aren't reconnects
+			if connected {
+				t.mu.Lock()
+				t.reconnects++
+				t.mu.Unlock()
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(retry):
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			lastErr = err
+			break
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("Cache-Control", "no-cache")
+		if params.idLocation == idInQuery {
+			q := req.URL.Query()
+			q.Set(params.idName, info.id)
+			req.URL.RawQuery = q.Encode()
+		} else {
+			req.Header.Set(params.idName, info.id)
+		}
+		if params.trace.enabled() {
+			var spanID string
+			res.traceID, spanID = traceIDs(params.runID, params.workerID, info.userID, info.count)
+			for _, h := range params.trace.headers(res.traceID, spanID) {
+				req.Header.Set(h[0], h[1])
+			}
+		}
+		if err := renderHeaders(params, info, req.Header.Set); err != nil {
+			lastErr = err
+			break
+		}
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		resp, err := t.client.Do(req)
+		if err != nil {
+			if ctx.Err() == nil {
+				lastErr = err
+			}
+			continue
+		}
+		if !connected {
+			res.code = resp.StatusCode
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("unexpected status code for event stream: %d", resp.StatusCode)
+			break
+		}
+		if !connected {
+			connected = true
+			t.mu.Lock()
+			t.streams++
+			t.mu.Unlock()
+		}
+		lastErr = nil
+
+		err = t.read(resp, &res, &lastEventID, &retry)
+		resp.Body.Close()
+		if err != nil && ctx.Err() == nil {
+			lastErr = err
+		}
+	}
+
+	if res.latency == 0 {
+		res.latency = time.Since(res.start)
+	}
+	if lastErr != nil && !connected {
+		if res.code == 0 {
+			res.code = -1
+		}
+		res.err = lastErr.Error()
+	}
+	return
+}
+
+// read consumes events from a stream until it ends, recording the time to the first event
+func (t *sseTarget) read(resp *http.Response, res *respStatus, lastEventID *string, retry *time.Duration) error {
+	reader := bufio.NewReader(resp.Body)
+	hasData := false
+	for {
+		line, err := reader.ReadString('\n')
+		res.bytesIn += len(line)
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if hasData {
+				t.mu.Lock()
+				t.events++
+				if res.latency == 0 {
+					res.latency = time.Since(res.start)
+					t.firstEventAt = append(t.firstEventAt, res.latency)
+				}
+				t.mu.Unlock()
+			}
+			hasData = false
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			hasData = true
+		case "id":
+			*lastEventID = value
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				*retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+func (t *sseTarget) summary() *sseSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &sseSummary{
+		Streams:          t.streams,
+		Reconnects:       t.reconnects,
+		Events:           t.events,
+		TimeToFirstEvent: summarizeLatencies(t.firstEventAt),
+	}
+	if t.streams > 0 {
+		s.EventsPerStream = float64(t.events) / float64(t.streams)
+	}
+	return s
+}
+
+func printSSESummary(s *sseSummary) {
+	fmt.Printf("Event streams: %d | Reconnects: %d | Events received: %d (%.1f per stream)\n",
+		s.Streams, s.Reconnects, s.Events, s.EventsPerStream)
+	fmt.Printf("Time to first event (ms): mean %.2f | p50 %.2f | p99 %.2f | max %.2f\n",
+		s.TimeToFirstEvent.Mean, s.TimeToFirstEvent.P50, s.TimeToFirstEvent.P99, s.TimeToFirstEvent.Max)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// requestTemplate renders request content such as bodies and messages for each request.
+// Templates use Go template syntax with the following variables:
+// {{.ID}}, {{.RID}}, {{.UID}}, {{.CID}} and {{.WID}}, along with variables captured by hooks and
+// fields of records drawn from feeders.
+type requestTemplate struct {
+	text string
+	tmpl *template.Template
+}
+
+func newRequestTemplate(name string, text string) (*requestTemplate, error) {
+	t := &requestTemplate{text: text}
+	if !strings.Contains(text, "{{") {
+		return t, nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+func (t *requestTemplate) render(vars map[string]string) (string, error) {
+	if t.tmpl == nil {
+		return t.text, nil
+	}
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&sb, vars); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// headerTemplate is a request header whose value is a template
+type headerTemplate struct {
+	name  string
+	value *requestTemplate
+}
+
+func newHeaderTemplates(headers map[string]string) ([]headerTemplate, error) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	templates := make([]headerTemplate, 0, len(names))
+	for _, name := range names {
+		value, err := newRequestTemplate("header "+name, headers[name])
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, headerTemplate{name: name, value: value})
+	}
+	return templates, nil
+}
+
+// templateVars returns the variables for a request: values captured by hooks, then feeder records,
+// then the request ids
+func templateVars(params *testParams, info reqInfo) map[string]string {
+	vars := make(map[string]string, len(params.vars)+len(info.vars)+5)
+	for k, v := range params.vars {
+		vars[k] = v
+	}
+	for k, v := range info.vars {
+		vars[k] = v
+	}
+	vars["ID"] = info.id
+	vars["RID"] = params.runID
+	vars["UID"] = strconv.Itoa(info.userID)
+	vars["CID"] = strconv.Itoa(info.count)
+	vars["WID"] = strconv.Itoa(params.workerID)
+	return vars
+}
+
+// renderURL renders the target URL of a request, whose path and query can use template variables
+func renderURL(params *testParams, info reqInfo) (string, error) {
+	if params.urlTemplate == nil {
+		return params.url, nil
+	}
+	return params.urlTemplate.render(templateVars(params, info))
+}
+
+// renderHeaders renders the templated headers of a request, calling set for each of them
+func renderHeaders(params *testParams, info reqInfo, set func(name string, value string)) error {
+	if len(params.headers) == 0 {
+		return nil
+	}
+	return setHeaders(params.headers, templateVars(params, info), set)
+}
+
+func setHeaders(headers []headerTemplate, vars map[string]string, set func(name string, value string)) error {
+	for _, h := range headers {
+		value, err := h.value.render(vars)
+		if err != nil {
+			return err
+		}
+		set(h.name, value)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Supported trace propagation formats
+const (
+	traceW3C      string = "w3c"
+	traceB3       string = "b3"
+	traceB3Single string = "b3single"
+)
+
+type traceConf struct {
+	w3c      bool
+	b3       bool
+	b3Single bool
+	state    string
+}
+
+// parseTraceConf reads a comma-separated list of propagation formats
+func parseTraceConf(formats string, state string) (traceConf, error) {
+	conf := traceConf{state: state}
+	for _, f := range strings.Split(formats, ",") {
+		switch strings.ToLower(strings.TrimSpace(f)) {
+		case "":
+		case traceW3C:
+			conf.w3c = true
+		case traceB3:
+			conf.b3 = true
+		case traceB3Single:
+			conf.b3Single = true
+		default:
+			return conf, fmt.Errorf("unknown trace propagation format: %q", f)
+		}
+	}
+	return conf, nil
+}
+
+func (conf traceConf) enabled() bool {
+	return conf.w3c || conf.b3 || conf.b3Single
+}
+
+// traceIDs derives a trace ID and a span ID from the RID/WID/UID/CID of a request,
+// so the same request in the same run always maps to the same trace.
+func traceIDs(runID string, workerID int, userID int, count int) (traceID string, spanID string) {
+	key := runID + "/" + strconv.Itoa(workerID) + "/" + strconv.Itoa(userID) + "/" + strconv.Itoa(count)
+	sum := sha256.Sum256([]byte(key))
+	// all-zero IDs are invalid for both W3C and B3
+	sum[15] |= 1
+	sum[23] |= 1
+	return hex.EncodeToString(sum[:16]), hex.EncodeToString(sum[16:24])
+}
+
+// headers returns the propagation headers for a request as name/value pairs
+func (conf traceConf) headers(traceID string, spanID string) [][2]string {
+	var h [][2]string
+	if conf.w3c {
+		h = append(h, [2]string{"traceparent", "00-" + traceID + "-" + spanID + "-01"})
+		if conf.state != "" {
+			h = append(h, [2]string{"tracestate", conf.state})
+		}
+	}
+	if conf.b3 {
+		h = append(h, [2]string{"X-B3-TraceId", traceID}, [2]string{"X-B3-SpanId", spanID}, [2]string{"X-B3-Sampled", "1"})
+	}
+	if conf.b3Single {
+		h = append(h, [2]string{"b3", traceID + "-" + spanID + "-1"})
+	}
+	return h
+}
+
+func (conf traceConf) apply(header *fasthttp.RequestHeader, traceID string, spanID string) {
+	for _, h := range conf.headers(traceID, spanID) {
+		header.Set(h[0], h[1])
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestParseTraceConf(t *testing.T) {
+	tests := []struct {
+		formats string
+		want    traceConf
+		wantErr bool
+	}{
+		{formats: "", want: traceConf{}},
+		{formats: "w3c", want: traceConf{w3c: true}},
+		{formats: "W3C, b3 ,b3single", want: traceConf{w3c: true, b3: true, b3Single: true}},
+		{formats: "b3,", want: traceConf{b3: true}},
+		{formats: "jaeger", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTraceConf(tt.formats, "")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseTraceConf(%q): expected an error", tt.formats)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseTraceConf(%q) = %+v (%v), want %+v", tt.formats, got, err, tt.want)
+		}
+	}
+}
+
+func TestTraceIDs(t *testing.T) {
+	hexID := regexp.MustCompile(`^[0-9a-f]+$`)
+	traceID, spanID := traceIDs("RID001", 0, 3, 42)
+	if len(traceID) != 32 || len(spanID) != 16 || !hexID.MatchString(traceID) || !hexID.MatchString(spanID) {
+		t.Fatalf("got trace ID %q and span ID %q", traceID, spanID)
+	}
+	if again, _ := traceIDs("RID001", 0, 3, 42); again != traceID {
+		t.Errorf("trace ID changed for the same request: %q, was %q", again, traceID)
+	}
+	tests := []struct {
+		runID    string
+		workerID int
+		userID   int
+		count    int
+	}{
+		{"RID002", 0, 3, 42},
+		{"RID001", 1, 3, 42},
+		{"RID001", 0, 4, 42},
+		{"RID001", 0, 3, 43},
+		// the fields are separated so 3/42 and 34/2 differ
+		{"RID001", 0, 34, 2},
+	}
+	for _, tt := range tests {
+		if other, _ := traceIDs(tt.runID, tt.workerID, tt.userID, tt.count); other == traceID {
+			t.Errorf("%+v: got the same trace ID as RID001/0/3/42", tt)
+		}
+	}
+}
+
+func TestTraceHeaders(t *testing.T) {
+	const traceID, spanID = "0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"
+	tests := []struct {
+		name string
+		conf traceConf
+		want [][2]string
+	}{
+		{name: "none", conf: traceConf{}},
+		{
+			name: "w3c",
+			conf: traceConf{w3c: true},
+			want: [][2]string{{"traceparent", "00-" + traceID + "-" + spanID + "-01"}},
+		},
+		{
+			name: "w3c with tracestate",
+			conf: traceConf{w3c: true, state: "vendor=x"},
+			want: [][2]string{{"traceparent", "00-" + traceID + "-" + spanID + "-01"}, {"tracestate", "vendor=x"}},
+		},
+		{
+			name: "tracestate only goes with w3c",
+			conf: traceConf{b3Single: true, state: "vendor=x"},
+			want: [][2]string{{"b3", traceID + "-" + spanID + "-1"}},
+		},
+		{
+			name: "b3",
+			conf: traceConf{b3: true},
+			want: [][2]string{{"X-B3-TraceId", traceID}, {"X-B3-SpanId", spanID}, {"X-B3-Sampled", "1"}},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.conf.headers(traceID, spanID); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
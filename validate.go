@@ -0,0 +1,542 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runPlan holds the settings of a run after test-level values and command-line options are applied
+type runPlan struct {
+	ID             string
+	URL            string
+	Type           string
+	Protocol       string
+	Requests       int
+	Concurrency    int
+	IDHeader       string
+	IDFormat       string
+	IDLocation     string
+	Trace          string
+	WSRate         float64
+	SSEDuration    time.Duration
+	Warmup         time.Duration
+	WarmupRequests int
+	PauseBefore    time.Duration
+	PauseAfter     time.Duration
+	StopOnFailure  bool
+	Group          string
+	Client         clientOptions
+	UnixSocket     string
+	Dial           string
+	Proxy          string
+	Headers        map[string]string
+}
+
+// plan resolves the settings of the run at index i. runCounter is the -run option, used as the
+// run ID of the first run when it isn't 1.
+func (conf *batchSpec) plan(i int, runCounter int) runPlan {
+	run := conf.Runs[i]
+	rid := runCounter
+	if rid == 1 {
+		rid = i + 1
+	}
+	p := runPlan{
+		ID:          override(run.CustomID, fmt.Sprintf("RID%03d", rid)),
+		URL:         override(run.CustomURL, conf.Url),
+		Type:        override(run.Type, conf.Type, runHTTP),
+		Protocol:    override(run.Protocol, conf.Protocol, protocolHTTP1),
+		Requests:    run.Requests,
+		Concurrency: run.Concurrency,
+		IDHeader:    override(run.IDHeader, conf.IDHeader),
+		IDFormat:    override(run.IDFormat, conf.IDFormat),
+		IDLocation:  override(run.IDLocation, conf.IDLocation),
+		Trace:       override(run.Trace, conf.Trace),
+		WSRate:      run.WSRate,
+		SSEDuration: run.SSEDuration,
+		Client:      run.Client.over(conf.Client),
+		UnixSocket:  override(run.UnixSocket, conf.UnixSocket),
+		Dial:        override(run.Dial, conf.Dial),
+		Proxy:       override(run.Proxy, conf.Proxy),
+		PauseBefore: run.PauseBefore,
+		PauseAfter:  run.PauseAfter,
+		Group:       run.ParallelGroup,
+	}
+	if p.WSRate == 0 {
+		p.WSRate = conf.WSRate
+	}
+	if p.SSEDuration == 0 {
+		p.SSEDuration = conf.SSEDuration
+	}
+	if p.PauseBefore == 0 {
+		p.PauseBefore = conf.PauseBefore
+	}
+	if p.PauseAfter == 0 {
+		p.PauseAfter = conf.PauseAfter
+	}
+	p.StopOnFailure = conf.StopOnFailure
+	if run.StopOnFailure != nil {
+		p.StopOnFailure = *run.StopOnFailure
+	}
+	// a warm-up set on the run replaces the test-level one, whichever kind it is
+	p.Warmup, p.WarmupRequests = run.Warmup, run.WarmupRequests
+	if p.Warmup == 0 && p.WarmupRequests == 0 {
+		p.Warmup, p.WarmupRequests = conf.Warmup, conf.WarmupRequests
+	}
+	if len(conf.Headers)+len(run.Headers) > 0 {
+		p.Headers = make(map[string]string)
+		for k, v := range conf.Headers {
+			p.Headers[k] = v
+		}
+		for k, v := range run.Headers {
+			p.Headers[k] = v
+		}
+	}
+	return p
+}
+
+// specError is an invalid value in a batch spec, located by line when it comes from a batch file
+type specError struct {
+	file string
+	line int
+	msg  string
+}
+
+func (e specError) Error() string {
+	if e.line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.file, e.line, e.msg)
+	}
+	return e.msg
+}
+
+// specLines finds the lines of keys in a batch file. A nil document (no batch file) has no lines.
+// files maps nodes to the file they come from, as included files are merged into the document.
+// origins maps runs expanded from a matrix or repeated to the runs they come from in the file.
+type specLines struct {
+	file    string
+	files   map[*yaml.Node]string
+	doc     *yaml.Node
+	origins []int
+}
+
+// fileOf returns the file a node comes from
+func (l specLines) fileOf(n *yaml.Node) string {
+	if f, ok := l.files[n]; ok {
+		return f
+	}
+	return l.file
+}
+
+// find returns the node at a path of mapping keys and sequence indexes
+func (l specLines) find(path ...interface{}) *yaml.Node {
+	if l.doc == nil || len(l.doc.Content) == 0 {
+		return nil
+	}
+	node := l.doc.Content[0]
+	for _, step := range path {
+		var next *yaml.Node
+		switch s := step.(type) {
+		case string:
+			if node.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(node.Content); i += 2 {
+					if node.Content[i].Value == s {
+						next = node.Content[i+1]
+					}
+				}
+			}
+		case int:
+			if node.Kind == yaml.SequenceNode && s < len(node.Content) {
+				next = node.Content[s]
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// runKey returns the node of a key for run i, falling back to the matrix, to the test-level key,
+// then to the run itself
+func (l specLines) runKey(i int, key ...string) *yaml.Node {
+	if i < len(l.origins) {
+		i = l.origins[i]
+	}
+	path := []interface{}{"runs", i}
+	for _, k := range key {
+		path = append(path, k)
+	}
+	if n := l.find(path...); n != nil {
+		return n
+	}
+	top := make([]interface{}, len(key))
+	for j, k := range key {
+		top[j] = k
+	}
+	if n := l.find(append([]interface{}{"matrix"}, top[0])...); n != nil {
+		return n
+	}
+	if n := l.find(top...); n != nil {
+		return n
+	}
+	if n := l.find("runs", i); n != nil {
+		return n
+	}
+	if n := l.find("matrix"); n != nil {
+		return n
+	}
+	return nil
+}
+
+func (l specLines) key(key string) *yaml.Node {
+	return l.find(key)
+}
+
+// validate checks a batch spec once command-line options are applied, returning every problem found
+func (conf *batchSpec) validate(lines specLines) []error {
+	var errs []error
+	fail := func(n *yaml.Node, format string, args ...interface{}) {
+		e := specError{file: lines.file, msg: fmt.Sprintf(format, args...)}
+		if n != nil {
+			e.file, e.line = lines.fileOf(n), n.Line
+		}
+		errs = append(errs, e)
+	}
+
+	if len(conf.Runs) == 0 {
+		fail(lines.key("runs"), "no runs defined")
+	}
+	if conf.RawFormat != "" && conf.RawFormat != rawJSONL && conf.RawFormat != rawCSV {
+		fail(lines.key("raw_format"), "unknown raw log format: %q", conf.RawFormat)
+	}
+	if conf.TLS.MinVersion != "" {
+		if _, ok := tlsVersions[conf.TLS.MinVersion]; !ok {
+			fail(lines.key("tls_min"), "unknown TLS version: %q", conf.TLS.MinVersion)
+		}
+	}
+	if conf.Interval < 0 {
+		fail(lines.key("interval"), "interval can't be negative")
+	}
+	for _, stage := range []string{"before", "after"} {
+		hooks := conf.Before
+		if stage == "after" {
+			hooks = conf.After
+		}
+		for j, h := range hooks {
+			if msg := h.check(); msg != "" {
+				fail(lines.find(stage, j), "%s hook %s: %s", stage, h.label(j), msg)
+			}
+		}
+	}
+
+	groups := make(map[string]bool)
+	for i, run := range conf.Runs {
+		p := conf.plan(i, 1)
+		name := "run " + strconv.Itoa(i+1)
+
+		if p.URL == "" {
+			fail(lines.runKey(i, "url"), "%s: url is required", name)
+		} else if p.Type == runGRPC {
+			// gRPC targets can also be a bare host:port
+			if addr, _, err := grpcAddress(p.URL); err != nil || addr == "" {
+				fail(lines.runKey(i, "url"), "%s: invalid gRPC target: %q", name, p.URL)
+			}
+		} else if u, err := url.Parse(p.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			fail(lines.runKey(i, "url"), "%s: invalid url: %q", name, p.URL)
+		}
+		if run.Requests <= 0 {
+			fail(lines.runKey(i, "requests"), "%s: requests must be greater than 0", name)
+		}
+		if run.Concurrency <= 0 {
+			fail(lines.runKey(i, "concurrency"), "%s: concurrency must be greater than 0", name)
+		}
+		if run.Interval < 0 {
+			fail(lines.runKey(i, "interval"), "%s: interval can't be negative", name)
+		}
+		for _, stage := range []string{"before", "after"} {
+			hooks := run.Before
+			if stage == "after" {
+				hooks = run.After
+			}
+			for j, h := range hooks {
+				if msg := h.check(); msg != "" {
+					fail(lines.runKey(i, stage), "%s: %s hook %s: %s", name, stage, h.label(j), msg)
+				}
+			}
+		}
+		for header, value := range p.Headers {
+			if _, err := newRequestTemplate("header "+header, value); err != nil {
+				fail(lines.runKey(i, "headers"), "%s: header %s: %v", name, header, err)
+			}
+		}
+		if strings.Contains(p.URL, "{{") {
+			if p.Type == runGRPC || p.Type == runWebSocket {
+				fail(lines.runKey(i, "url"), "%s: url templates are not supported for %s runs", name, p.Type)
+			} else if _, err := newRequestTemplate("url", p.URL); err != nil {
+				fail(lines.runKey(i, "url"), "%s: url: %v", name, err)
+			}
+		}
+		if len(run.Scenario) > 0 {
+			if p.Type != runHTTP {
+				fail(lines.runKey(i, "scenario"), "%s: scenarios are only supported for http runs", name)
+			}
+			if run.Body != "" {
+				fail(lines.runKey(i, "body"), "%s: body can't be used with a scenario, set the body of each step instead", name)
+			}
+			if _, err := newScenario(p.URL, run.Scenario, p.IDLocation == idInBody); err != nil {
+				fail(lines.runKey(i, "scenario"), "%s: scenario %v", name, err)
+			}
+			for _, st := range run.Scenario {
+				if st.Body != "" && p.IDLocation == idInBody {
+					fail(lines.runKey(i, "id_location"), "%s: the id can't be sent in the body of scenario steps with a body, use a header or a query parameter instead", name)
+					break
+				}
+			}
+		} else if body := override(run.Body, conf.Body); p.Type == runHTTP && body != "" {
+			if p.IDLocation == idInBody {
+				fail(lines.runKey(i, "body"), "%s: the id can't be sent in the body of http requests with a body, use a header or a query parameter instead", name)
+			}
+			if _, err := newRequestTemplate("body", body); err != nil {
+				fail(lines.runKey(i, "body"), "%s: body: %v", name, err)
+			}
+		}
+		for j, spec := range run.Feeders {
+			if _, err := newFeeder(spec); err != nil {
+				fail(lines.runKey(i, "feeders"), "%s: feeder %s: %v", name, spec.label(j), err)
+			}
+		}
+		if conf.IsDistributed {
+			// workers only send single requests
+			if len(run.Feeders) > 0 {
+				fail(lines.runKey(i, "feeders"), "%s: feeders are not supported in distributed mode", name)
+			}
+			if len(run.Scenario) > 0 {
+				fail(lines.runKey(i, "scenario"), "%s: scenarios are not supported in distributed mode", name)
+			}
+			if p.Type == runWebSocket || p.Type == runSSE {
+				fail(lines.runKey(i, "type"), "%s: %s runs are not supported in distributed mode", name, p.Type)
+			}
+		}
+
+		switch p.Type {
+		case runHTTP, runGRPC, runGraphQL, runWebSocket, runSSE:
+		default:
+			fail(lines.runKey(i, "type"), "%s: unknown run type: %q", name, p.Type)
+		}
+		switch p.Protocol {
+		case protocolHTTP1, protocolH2, protocolH2C:
+		default:
+			fail(lines.runKey(i, "protocol"), "%s: unknown protocol: %q", name, p.Protocol)
+		}
+		switch p.IDLocation {
+		case idInHeader, idInQuery, idInBody:
+			if p.IDLocation == idInBody && (p.Type == runGraphQL || p.Type == runSSE) {
+				fail(lines.runKey(i, "id_location"), "%s: the id can't be sent in the body of %s requests", name, p.Type)
+			}
+		default:
+			fail(lines.runKey(i, "id_location"), "%s: unknown id location: %q", name, p.IDLocation)
+		}
+		if _, err := parseIDFormat(p.IDFormat); err != nil {
+			fail(lines.runKey(i, "id_format"), "%s: %v", name, err)
+		}
+		if _, err := parseTraceConf(p.Trace, ""); err != nil {
+			fail(lines.runKey(i, "trace"), "%s: %v", name, err)
+		}
+
+		switch p.Type {
+		case runGRPC:
+			if _, _, err := splitGRPCMethod(override(run.Method, conf.Method)); err != nil {
+				fail(lines.runKey(i, "method"), "%s: %v", name, err)
+			}
+		case runGraphQL:
+			if override(run.Query, conf.Query) == "" {
+				fail(lines.runKey(i, "query"), "%s: a query document file is required for GraphQL runs", name)
+			}
+		case runWebSocket:
+			if p.WSRate < 0 {
+				fail(lines.runKey(i, "ws_rate"), "%s: ws_rate can't be negative", name)
+			}
+		case runSSE:
+			if p.SSEDuration <= 0 {
+				fail(lines.runKey(i, "sse_duration"), "%s: sse_duration must be greater than 0", name)
+			}
+		}
+
+		if p.Warmup < 0 {
+			fail(lines.runKey(i, "warmup"), "%s: warmup can't be negative", name)
+		}
+		if p.WarmupRequests < 0 {
+			fail(lines.runKey(i, "warmup_requests"), "%s: warmup_requests can't be negative", name)
+		}
+		if p.Warmup > 0 && p.WarmupRequests > 0 {
+			fail(lines.runKey(i, "warmup_requests"), "%s: set either warmup or warmup_requests, not both", name)
+		}
+		if p.Warmup != 0 || p.WarmupRequests != 0 {
+			key := "warmup"
+			if p.Warmup == 0 {
+				key = "warmup_requests"
+			}
+			if p.Type == runWebSocket {
+				fail(lines.runKey(i, key), "%s: warm-up is not supported for websocket runs", name)
+			}
+			if conf.IsDistributed {
+				fail(lines.runKey(i, key), "%s: warm-up is not supported in distributed mode", name)
+			}
+		}
+
+		if p.PauseBefore < 0 {
+			fail(lines.runKey(i, "pause_before"), "%s: pause_before can't be negative", name)
+		}
+		if p.PauseAfter < 0 {
+			fail(lines.runKey(i, "pause_after"), "%s: pause_after can't be negative", name)
+		}
+		if run.Repeat < 0 {
+			fail(lines.runKey(i, "repeat"), "%s: repeat can't be negative", name)
+		}
+		if p.Group != "" {
+			if run.Repeat > 1 {
+				fail(lines.runKey(i, "repeat"), "%s: repeat can't be used with parallel_group", name)
+			}
+			if conf.IsDistributed {
+				fail(lines.runKey(i, "parallel_group"), "%s: parallel groups are not supported in distributed mode", name)
+			}
+			if groups[p.Group] && conf.Runs[i-1].ParallelGroup != p.Group {
+				fail(lines.runKey(i, "parallel_group"), "%s: runs in parallel group %q must be listed together", name, p.Group)
+			}
+			groups[p.Group] = true
+		}
+
+		if _, err := parseProxyURL(p.Proxy); err != nil {
+			fail(lines.runKey(i, "proxy"), "%s: %v", name, err)
+		}
+		if p.Dial != "" {
+			if _, _, err := net.SplitHostPort(p.Dial); err != nil {
+				fail(lines.runKey(i, "dial"), "%s: invalid dial address %q: %v", name, p.Dial, err)
+			}
+			proxy, _ := parseProxyURL(p.Proxy)
+			forwarded := p.Type == runSSE || ((p.Type == runHTTP || p.Type == runGraphQL) && p.Protocol != protocolH2C)
+			if forwarded && forwardsRequests(proxy, p.URL) {
+				fail(lines.runKey(i, "dial"), "%s: dial can't be used for http targets behind an HTTP proxy, which forwards requests itself", name)
+			}
+		}
+		if p.UnixSocket != "" && (p.Dial != "" || p.Proxy != "") {
+			fail(lines.runKey(i, "unix_socket"), "%s: unix_socket can't be used with dial or proxy", name)
+		}
+
+		c := p.Client
+		for _, v := range []struct {
+			key      string
+			negative bool
+		}{
+			{"read_timeout", c.ReadTimeout < 0},
+			{"write_timeout", c.WriteTimeout < 0},
+			{"max_conns", c.MaxConns < 0},
+			{"max_idle_conn_duration", c.MaxIdleConnDuration < 0},
+			{"read_buffer_size", c.ReadBufferSize < 0},
+			{"write_buffer_size", c.WriteBufferSize < 0},
+		} {
+			if v.negative {
+				fail(lines.runKey(i, "client", v.key), "%s: client %s can't be negative", name, v.key)
+			}
+		}
+	}
+	return errs
+}
+
+// printPlan writes the resolved settings of each run, as used by -dry-run and "blowhole validate"
+func (conf *batchSpec) printPlan(w io.Writer, runCounter int) {
+	fmt.Fprintf(w, "Test %q: %d runs\n", conf.Name, len(conf.Runs))
+	for i := range conf.Runs {
+		p := conf.plan(i, runCounter)
+		c := p.Client
+
+		fmt.Fprintf(w, "%s\nRun %s\n", separator, p.ID)
+		if label := conf.Runs[i].Label; label != "" {
+			fmt.Fprintf(w, "  label:        %s\n", label)
+		}
+		fmt.Fprintf(w, "  url:          %s\n", p.URL)
+		fmt.Fprintf(w, "  type:         %s (%s)\n", p.Type, p.Protocol)
+		fmt.Fprintf(w, "  requests:     %d\n", p.Requests)
+		fmt.Fprintf(w, "  concurrency:  %d\n", p.Concurrency)
+		switch p.Type {
+		case runWebSocket:
+			rate := "unlimited"
+			if p.WSRate > 0 {
+				rate = fmt.Sprintf("%g messages/s per user", p.WSRate)
+			}
+			fmt.Fprintf(w, "  rate:         %s\n", rate)
+		case runSSE:
+			fmt.Fprintf(w, "  rate:         unlimited, streams held for %s\n", p.SSEDuration)
+		default:
+			fmt.Fprintf(w, "  rate:         unlimited\n")
+		}
+		fmt.Fprintf(w, "  id:           %s %q, format %q\n", p.IDLocation, p.IDHeader, p.IDFormat)
+		if p.Trace != "" {
+			fmt.Fprintf(w, "  trace:        %s\n", p.Trace)
+		}
+		if p.Warmup > 0 {
+			fmt.Fprintf(w, "  warm-up:      %s, excluded from results\n", p.Warmup)
+		} else if p.WarmupRequests > 0 {
+			fmt.Fprintf(w, "  warm-up:      %d requests, excluded from results\n", p.WarmupRequests)
+		}
+		if p.Group != "" {
+			fmt.Fprintf(w, "  parallel:     group %q\n", p.Group)
+		}
+		if p.PauseBefore > 0 || p.PauseAfter > 0 {
+			fmt.Fprintf(w, "  pauses:       %s before, %s after\n", p.PauseBefore, p.PauseAfter)
+		}
+		if p.StopOnFailure {
+			fmt.Fprintf(w, "  on failure:   stop remaining runs\n")
+		}
+		if s, err := newScenario(p.URL, conf.Runs[i].Scenario, p.IDLocation == idInBody); err == nil && len(s.steps) > 0 {
+			fmt.Fprintf(w, "  scenario:     %s\n", strings.Join(s.names(), " -> "))
+		}
+		for j, spec := range conf.Runs[i].Feeders {
+			f := spec
+			f.Order, f.Per = override(f.Order, feedSequential), override(f.Per, feedPerRequest)
+			fmt.Fprintf(w, "  feeder:       %s, %s per %s, from %s\n", spec.label(j), f.Order, f.Per, f.File)
+		}
+		if len(p.Headers) > 0 {
+			fmt.Fprintf(w, "  headers:      %d\n", len(p.Headers))
+		}
+		run := conf.Runs[i]
+		if n := len(run.Before) + len(run.After); n > 0 {
+			fmt.Fprintf(w, "  hooks:        %d before, %d after\n", len(run.Before), len(run.After))
+		}
+
+		keepAlive := c.KeepAlive == nil || *c.KeepAlive
+		normalize := c.NormalizeHeaders != nil && *c.NormalizeHeaders
+		fmt.Fprintf(w, "  client:       read timeout %s, write timeout %s, max conns %d, keep-alive %t\n",
+			c.ReadTimeout, c.WriteTimeout, c.MaxConns, keepAlive)
+		fmt.Fprintf(w, "                idle duration %s, buffers %s/%s, normalize headers %t\n",
+			defaultLabel(c.MaxIdleConnDuration.String(), c.MaxIdleConnDuration == 0),
+			defaultLabel(strconv.Itoa(c.ReadBufferSize), c.ReadBufferSize == 0),
+			defaultLabel(strconv.Itoa(c.WriteBufferSize), c.WriteBufferSize == 0), normalize)
+		if p.UnixSocket != "" {
+			fmt.Fprintf(w, "  unix socket:  %s\n", p.UnixSocket)
+		}
+		if p.Dial != "" {
+			fmt.Fprintf(w, "  dial:         %s\n", p.Dial)
+		}
+		if p.Proxy != "" {
+			if u, err := url.Parse(p.Proxy); err == nil {
+				fmt.Fprintf(w, "  proxy:        %s\n", u.Redacted())
+			}
+		}
+	}
+	fmt.Fprintln(w, separator)
+}
+
+func defaultLabel(value string, isDefault bool) string {
+	if isDefault {
+		return "default"
+	}
+	return value
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// validSpec holds the settings that command-line defaults fill in before a batch is validated
+const validSpec = "url: http://target/\nid_header: id\nid_format: \"{RID}.{UID}.{CID}\"\nid_location: header\n"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr string
+	}{
+		{name: "valid", spec: "runs:\n  - {requests: 10, concurrency: 2}\n"},
+		{
+			name:    "concurrency 0",
+			spec:    "runs:\n  - requests: 10\n    concurrency: 0\n",
+			wantErr: "test.yml:7: run 1: concurrency must be greater than 0",
+		},
+		{
+			name:    "unknown protocol",
+			spec:    "protocol: h3\nruns:\n  - {requests: 10, concurrency: 2}\n",
+			wantErr: `test.yml:5: run 1: unknown protocol: "h3"`,
+		},
+		{
+			name:    "dial with an HTTP proxy forwarding http requests",
+			spec:    "proxy: http://proxy:3128\nruns:\n  - {requests: 10, concurrency: 2, dial: \"10.0.0.1:80\"}\n",
+			wantErr: "run 1: dial can't be used for http targets behind an HTTP proxy",
+		},
+		{
+			name: "dial with an HTTP proxy tunneling h2c",
+			spec: "proxy: http://proxy:3128\nprotocol: h2c\nruns:\n  - {requests: 10, concurrency: 2, dial: \"10.0.0.1:80\"}\n",
+		},
+		{
+			name:    "warm-up in distributed mode",
+			spec:    "distributed: true\nruns:\n  - {requests: 10, concurrency: 2, warmup_requests: 5}\n",
+			wantErr: "run 1: warm-up is not supported in distributed mode",
+		},
+		{
+			name:    "warm-up for websocket runs",
+			spec:    "runs:\n  - {url: \"ws://target/\", type: websocket, requests: 10, concurrency: 2, warmup: 1s}\n",
+			wantErr: "run 1: warm-up is not supported for websocket runs",
+		},
+		{
+			name: "bare gRPC target",
+			spec: "runs:\n  - {url: \"localhost:50051\", type: grpc, method: pkg.Svc/Call, requests: 10, concurrency: 2}\n",
+		},
+		{
+			name:    "unknown run type",
+			spec:    "runs:\n  - {type: ftp, requests: 10, concurrency: 2}\n",
+			wantErr: `run 1: unknown run type: "ftp"`,
+		},
+		{
+			name:    "no runs",
+			spec:    "runs: []\n",
+			wantErr: "no runs defined",
+		},
+	}
+	for _, tt := range tests {
+		dir := writeSpecFiles(t, map[string]string{"test.yml": validSpec + tt.spec})
+		var conf batchSpec
+		lines, err := conf.getConf(filepath.Join(dir, "test.yml"), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		errs := conf.validate(lines)
+		if tt.wantErr == "" {
+			if len(errs) > 0 {
+				t.Errorf("%s: unexpected errors: %v", tt.name, errs)
+			}
+			continue
+		}
+		if got := fmt.Sprint(errs); !strings.Contains(got, tt.wantErr) {
+			t.Errorf("%s: got errors %s, want %q", tt.name, got, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// batchVariable matches ${VAR} and ${VAR:-default} references in batch files. $${ is a literal ${.
+var batchVariable = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_.-]*)(:-[^}]*)?\}`)
+
+// setFlags collects repeated -set key=value options
+type setFlags map[string]string
+
+func (s setFlags) String() string {
+	pairs := make([]string, 0, len(s))
+	for k, v := range s {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (s setFlags) Set(value string) error {
+	key, v, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	s[key] = v
+	return nil
+}
+
+// expandVariables replaces variable references in the scalars of a parsed batch file with values set with -set,
+// then with environment variables, then with their default. References without a value or a default are errors.
+// Values are never parsed as YAML, but unquoted scalars are typed after expansion, so counts can be variables.
+func expandVariables(n *yaml.Node, vars map[string]string) error {
+	var missing []string
+	var expand func(n *yaml.Node)
+	expand = func(n *yaml.Node) {
+		if n.Kind == yaml.ScalarNode {
+			value := expandString(n.Value, vars, &missing)
+			if value != n.Value && n.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+				n.Tag = ""
+			}
+			n.Value = value
+		}
+		for _, c := range n.Content {
+			expand(c)
+		}
+	}
+	expand(n)
+	if len(missing) > 0 {
+		return fmt.Errorf("no value for variables: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func expandString(text string, vars map[string]string, missing *[]string) string {
+	return batchVariable.ReplaceAllStringFunc(text, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		m := batchVariable.FindStringSubmatch(ref)
+		name, def := m[1], m[2]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		if v, ok := os.LookupEnv(name); ok && (v != "" || def == "") {
+			return v
+		}
+		if def != "" {
+			return strings.TrimPrefix(def, ":-")
+		}
+		*missing = append(*missing, name)
+		return ref
+	})
+}
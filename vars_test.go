@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExpandVariables(t *testing.T) {
+	t.Setenv("BH_TEST_ENV", "from-env")
+	t.Setenv("BH_TEST_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		text    string
+		vars    map[string]string
+		check   func(conf batchSpec) string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "comment characters in values",
+			text:  "headers:\n  Authorization: Bearer ${TOKEN}\n",
+			vars:  map[string]string{"TOKEN": "abc #def"},
+			check: func(conf batchSpec) string { return conf.Headers["Authorization"] },
+			want:  "Bearer abc #def",
+		},
+		{
+			name:  "YAML syntax in values",
+			text:  "name: ${NAME}\n",
+			vars:  map[string]string{"NAME": "a: b\nurl: http://injected/"},
+			check: func(conf batchSpec) string { return conf.Name + "|" + conf.Url },
+			want:  "a: b\nurl: http://injected/|",
+		},
+		{
+			name:  "references in comments",
+			text:  "# url: ${NOT_SET}\nname: test\n",
+			check: func(conf batchSpec) string { return conf.Name },
+			want:  "test",
+		},
+		{
+			name:  "sources and defaults",
+			text:  "name: ${BH_TEST_ENV}/${BH_TEST_EMPTY:-default}/${NOT_SET:-}/${BH_TEST_ENV:-x}\nurl: ${BH_TEST_ENV}\n",
+			vars:  map[string]string{"BH_TEST_ENV": "from-set"},
+			check: func(conf batchSpec) string { return conf.Name + "|" + conf.Url },
+			want:  "from-set/default//from-set|from-set",
+		},
+		{
+			name:  "environment",
+			text:  "name: ${BH_TEST_ENV}\n",
+			check: func(conf batchSpec) string { return conf.Name },
+			want:  "from-env",
+		},
+		{
+			name:  "literal references",
+			text:  "body: '{\"ref\": \"$${ID}\"}'\n",
+			check: func(conf batchSpec) string { return conf.Body },
+			want:  `{"ref": "${ID}"}`,
+		},
+		{
+			name:  "typed after expansion",
+			text:  "runs:\n  - requests: ${N}\n    label: \"${N}\"\n",
+			vars:  map[string]string{"N": "5000"},
+			check: func(conf batchSpec) string { return conf.Runs[0].Label + "|" + strconv.Itoa(conf.Runs[0].Requests) },
+			want:  "5000|5000",
+		},
+		{
+			name:    "missing variables",
+			text:    "name: ${A}\nurl: ${B:-ok}\nbody: ${C}\n",
+			wantErr: "no value for variables: A, C",
+		},
+	}
+
+	for _, tt := range tests {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(tt.text), &doc); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		err := expandVariables(&doc, tt.vars)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var conf batchSpec
+		if err := decodeStrict(doc.Content[0], &conf); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := tt.check(conf); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// warmupPhase sends traffic before a run is measured, for a duration or a number of requests.
+// Warm-up responses are kept out of the run stats and summarized separately.
+type warmupPhase struct {
+	duration time.Duration
+	requests int
+
+	start   time.Time
+	end     time.Time
+	users   sync.WaitGroup
+	release chan struct{}
+
+	// updated by statusWorker only
+	sent      int
+	codes     [6]int
+	failed    int
+	latencies []time.Duration
+}
+
+type warmupSummary struct {
+	Requests int            `json:"requests"`
+	Duration float64        `json:"duration_s"`
+	Codes    [6]int         `json:"response_codes"`
+	Failed   int            `json:"failed"`
+	Latency  latencySummary `json:"latency"`
+}
+
+func newWarmupPhase(duration time.Duration, requests int) *warmupPhase {
+	if duration <= 0 && requests <= 0 {
+		return nil
+	}
+	return &warmupPhase{duration: duration, requests: requests, release: make(chan struct{})}
+}
+
+// begin starts the phase for the given number of users. Once all of them are done warming up,
+// the run stats start and measured requests are released.
+func (w *warmupPhase) begin(params *testParams, users int) {
+	w.start = time.Now()
+	w.users.Add(users)
+	if w.duration > 0 {
+		fmt.Printf("Warming up for %s\n", w.duration)
+	} else {
+		fmt.Printf("Warming up with %d requests\n", w.requests)
+	}
+	go func() {
+		w.users.Wait()
+		w.end = time.Now()
+		// statusWorker reads start for measured responses only. Users send those after receiving
+		// from release, so this write happens before any of those reads without a lock.
+		params.stats.start = w.end
+		params.pbar.Reset()
+		close(w.release)
+	}()
+}
+
+// share returns the number of warm-up requests for a user. For timed warm-ups, it is 1 for users
+// that warm up until the deadline and 0 for the extra user sending remainder requests.
+func (w *warmupPhase) share(userID int, users int) int {
+	if w.duration > 0 {
+		if userID < users {
+			return 1
+		}
+		return 0
+	}
+	if userID < users {
+		return w.requests / users
+	}
+	return w.requests % users
+}
+
+// run sends the warm-up requests of a user, then waits for every user to be done.
+// It returns the number of requests sent, so measured requests carry on with the next ids.
+func (w *warmupPhase) run(params *testParams, userID int) int {
+	share := w.share(userID, params.concurrentUsers)
+	count := 0
+	deadline := w.start.Add(w.duration)
+	for (w.duration > 0 && share > 0 && time.Now().Before(deadline)) || (w.duration <= 0 && count < share) {
+		info, err := newReqInfo(params, userID, count)
+		if err != nil {
+			break
+		}
+		count++
+		if params.scenario != nil {
+			params.scenario.run(params, info, func(res respStatus) {
+				res.warmup = true
+				params.statusChan <- res
+			})
+			continue
+		}
+		var res respStatus
+		if params.sse != nil {
+			res = params.sse.session(params, info)
+		} else {
+			res = sendRequest(params, info)
+		}
+		res.warmup = true
+		params.statusChan <- res
+	}
+	w.users.Done()
+	<-w.release
+	return count
+}
+
+func (w *warmupPhase) add(res respStatus) {
+	w.sent++
+	w.codes[statusClass(res.code)]++
+	if res.err != "" {
+		w.failed++
+	}
+	if res.code > 0 {
+		w.latencies = append(w.latencies, res.latency)
+	}
+}
+
+func (w *warmupPhase) summary() *warmupSummary {
+	return &warmupSummary{
+		Requests: w.sent,
+		Duration: w.end.Sub(w.start).Seconds(),
+		Codes:    w.codes,
+		Failed:   w.failed,
+		Latency:  summarizeLatencies(w.latencies),
+	}
+}
+
+func printWarmupSummary(s *warmupSummary) {
+	fmt.Printf("Warm-up (excluded): %d requests in %.1fs | 2xx: %d | non-2xx: %d | failed: %d | p50 %.2f ms | p99 %.2f ms\n",
+		s.Requests, s.Duration, s.Codes[1], s.Requests-s.Codes[1], s.Failed, s.Latency.P50, s.Latency.P99)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const runWebSocket string = "websocket"
+
+type wsOptions struct {
+	rate      float64
+	waitReply bool
+	message   string
+	timeout   time.Duration
+	tlsConfig *tls.Config
+	dial      dialFunc
+}
+
+// wsTarget keeps one WebSocket connection per user, sending a templated message for each request
+type wsTarget struct {
+	dialer    *websocket.Dialer
+	interval  time.Duration
+	waitReply bool
+	message   *requestTemplate
+	timeout   time.Duration
+
+	mu          sync.Mutex
+	connects    int
+	connectErrs int
+	connectTime []time.Duration
+	disconnects int
+	closeCodes  map[int]int
+}
+
+type wsSummary struct {
+	Connects        int            `json:"connects"`
+	ConnectFailures int            `json:"connect_failures"`
+	ConnectLatency  latencySummary `json:"connect_latency"`
+	Disconnects     int            `json:"disconnects"`
+	CloseCodes      map[string]int `json:"close_codes,omitempty"`
+	// Replies is set when messages wait for replies. Run latencies are then message round-trips,
+	// otherwise they only measure the time to write each message.
+	Replies bool `json:"replies"`
+}
+
+func newWSTarget(opts wsOptions) (*wsTarget, error) {
+	message, err := newRequestTemplate("websocket message", opts.message)
+	if err != nil {
+		return nil, err
+	}
+	t := &wsTarget{
+		dialer: &websocket.Dialer{
+			TLSClientConfig:  opts.tlsConfig.Clone(),
+			HandshakeTimeout: opts.timeout,
+			NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return opts.dial(ctx, addr)
+			},
+		},
+		waitReply:  opts.waitReply,
+		message:    message,
+		timeout:    opts.timeout,
+		closeCodes: make(map[int]int),
+	}
+	if opts.rate > 0 {
+		t.interval = time.Duration(float64(time.Second) / opts.rate)
+	}
+	return t, nil
+}
+
+// connect opens a connection, with templated headers rendered for the request that needs it
+func (t *wsTarget) connect(params *testParams, info reqInfo) (*websocket.Conn, error) {
+	header := http.Header{}
+	if err := renderHeaders(params, info, header.Set); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	conn, _, err := t.dialer.Dial(params.url, header)
+	elapsed := time.Since(start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.connectErrs++
+		return nil, err
+	}
+	t.connects++
+	t.connectTime = append(t.connectTime, elapsed)
+	return conn, nil
+}
+
+// closed records how a connection ended. Unexpected closes count as disconnects.
+func (t *wsTarget) closed(err error, expected bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var ce *websocket.CloseError
+	if errors.As(err, &ce) {
+		t.closeCodes[ce.Code]++
+		if ce.Code == websocket.CloseNormalClosure || ce.Code == websocket.CloseGoingAway {
+			return
+		}
+	}
+	if !expected {
+		t.disconnects++
+	}
+}
+
+// iterate sends target messages for a user over a long-lived connection, reconnecting after disconnects
+func (t *wsTarget) iterate(params *testParams, target int, userID int) {
+	var conn *websocket.Conn
+	var readErr chan error
+	var ticker *time.Ticker
+	if t.interval > 0 {
+		ticker = time.NewTicker(t.interval)
+		defer ticker.Stop()
+	}
+
+	for i := 0; i < target; i++ {
+		if ticker != nil && i > 0 {
+			<-ticker.C
+		}
+		info, err := newReqInfo(params, userID, i)
+		if err != nil {
+			return
+		}
+		res := respStatus{id: info.id, endpoint: params.url}
+
+		if conn == nil {
+			conn, err = t.connect(params, info)
+			if err != nil {
+				res.code = -1
+				res.err = err.Error()
+				params.statusChan <- res
+				progress(params)
+				continue
+			}
+			if !t.waitReply {
+				readErr = make(chan error, 1)
+				go t.drain(conn, readErr)
+			}
+		}
+
+		res, err = t.send(params, conn, info, res)
+		params.statusChan <- res
+		progress(params)
+
+		select {
+		case err := <-readErr:
+			t.closed(err, false)
+			conn.Close()
+			conn = nil
+		default:
+			if err != nil {
+				t.closed(err, false)
+				conn.Close()
+				conn = nil
+			}
+		}
+	}
+
+	if conn != nil {
+		deadline := time.Now().Add(time.Second)
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+		if readErr != nil {
+			select {
+			case err := <-readErr:
+				t.closed(err, true)
+			case <-time.After(time.Second):
+			}
+		}
+		conn.Close()
+	}
+}
+
+// send writes a message and, if replies are awaited, reads until one contains the message id.
+// Errors returned are connection errors, after which the connection can't be used anymore.
+func (t *wsTarget) send(params *testParams, conn *websocket.Conn, info reqInfo, res respStatus) (respStatus, error) {
+	message, err := t.message.render(templateVars(params, info))
+	if err != nil {
+		res.code = -1
+		res.err = err.Error()
+		return res, nil
+	}
+	if message == "" {
+		message = string(idBody(params.idName, info.id))
+	}
+
+	if params.metrics != nil {
+		params.metrics.requestSent(params.name, params.runID)
+		defer params.metrics.requestFinished(params.name, params.runID)
+	}
+	res.start = time.Now()
+	if t.timeout > 0 {
+		_ = conn.SetWriteDeadline(res.start.Add(t.timeout))
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		res.code = -1
+		res.err = err.Error()
+		return res, err
+	}
+	res.bytesOut = len(message)
+
+	if t.waitReply {
+		if t.timeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(t.timeout))
+		}
+		for {
+			_, reply, err := conn.ReadMessage()
+			if err != nil {
+				res.latency = time.Since(res.start)
+				res.code = -1
+				res.err = err.Error()
+				return res, err
+			}
+			res.bytesIn += len(reply)
+			if strings.Contains(string(reply), info.id) {
+				break
+			}
+		}
+	}
+	res.latency = time.Since(res.start)
+	res.code = http.StatusOK
+	return res, nil
+}
+
+// drain reads and discards incoming messages until the connection ends
+func (t *wsTarget) drain(conn *websocket.Conn, readErr chan error) {
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			readErr <- err
+			return
+		}
+	}
+}
+
+func (t *wsTarget) summary() *wsSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &wsSummary{
+		Connects:        t.connects,
+		ConnectFailures: t.connectErrs,
+		ConnectLatency:  summarizeLatencies(t.connectTime),
+		Disconnects:     t.disconnects,
+		CloseCodes:      make(map[string]int),
+		Replies:         t.waitReply,
+	}
+	for code, n := range t.closeCodes {
+		s.CloseCodes[strconv.Itoa(code)] = n
+	}
+	return s
+}
+
+func printWSSummary(s *wsSummary) {
+	fmt.Printf("WebSocket connections: %d (%d failed) | Disconnects: %d\n", s.Connects, s.ConnectFailures, s.Disconnects)
+	fmt.Printf("Connect time (ms): mean %.2f | p50 %.2f | p99 %.2f | max %.2f\n",
+		s.ConnectLatency.Mean, s.ConnectLatency.P50, s.ConnectLatency.P99, s.ConnectLatency.Max)
+	if len(s.CloseCodes) > 0 {
+		codes := make([]string, 0, len(s.CloseCodes))
+		for code := range s.CloseCodes {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for i, code := range codes {
+			codes[i] = fmt.Sprintf("%s: %d", code, s.CloseCodes[code])
+		}
+		fmt.Printf("Close codes received: %s\n", strings.Join(codes, " | "))
+	}
+}